@@ -0,0 +1,257 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package analysis detects the change points of the metric series of a
+// history.
+//
+// The detection uses a binary segmentation: the series is split where the
+// CUSUM statistic is maximal and the split is kept only if a permutation test
+// shows it's statistically significant. Each side of a kept split is then
+// analyzed recursively.
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/stats"
+)
+
+const (
+	DefaultPValue       = 0.01
+	DefaultPermutations = 199
+	DefaultMinSize      = 3
+)
+
+// Config configures the detection.
+// Zero values are replaced by the defaults.
+type Config struct {
+	// PValue is the significance level of the permutation test.
+	PValue float64
+	// Permutations is the number of permutations of the test.
+	Permutations int
+	// MinSize is the minimum number of points on each side of a change.
+	MinSize int
+	// Seed makes the permutations reproducible.
+	Seed uint64
+}
+
+func (c Config) withDefaults() Config {
+	if c.PValue <= 0 {
+		c.PValue = DefaultPValue
+	}
+	if c.Permutations <= 0 {
+		c.Permutations = DefaultPermutations
+	}
+	if c.MinSize <= 0 {
+		c.MinSize = DefaultMinSize
+	}
+	return c
+}
+
+// ChangePoint is a step in a series.
+type ChangePoint struct {
+	// Index is the first point after the step.
+	Index int
+	// Before and After are the means of the segments around the step.
+	Before float64
+	After  float64
+	PValue float64
+}
+
+// ChangePoints returns the change points of the series ordered by index.
+func ChangePoints(series []float64, cfg Config) []ChangePoint {
+	cfg = cfg.withDefaults()
+	rnd := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+
+	var cps []ChangePoint
+	detect(series, 0, cfg, rnd, &cps)
+
+	sort.Slice(cps, func(i, j int) bool {
+		return cps[i].Index < cps[j].Index
+	})
+
+	// compute the segments means around each change point.
+	for i := range cps {
+		start := 0
+		if i > 0 {
+			start = cps[i-1].Index
+		}
+		end := len(series)
+		if i < len(cps)-1 {
+			end = cps[i+1].Index
+		}
+
+		cps[i].Before = stats.Mean(series[start:cps[i].Index])
+		cps[i].After = stats.Mean(series[cps[i].Index:end])
+	}
+
+	return cps
+}
+
+func detect(series []float64, offset int, cfg Config, rnd *rand.Rand, cps *[]ChangePoint) {
+	if len(series) < 2*cfg.MinSize {
+		return
+	}
+
+	idx, stat := cusum(series, cfg.MinSize)
+	if stat == 0 {
+		return
+	}
+
+	// permutation test: count how many shuffled series have a stronger
+	// change than the observed one.
+	perm := make([]float64, len(series))
+	copy(perm, series)
+
+	count := 0
+	for range cfg.Permutations {
+		rnd.Shuffle(len(perm), func(i, j int) {
+			perm[i], perm[j] = perm[j], perm[i]
+		})
+		if _, s := cusum(perm, cfg.MinSize); s >= stat {
+			count++
+		}
+	}
+
+	pvalue := float64(count+1) / float64(cfg.Permutations+1)
+	if pvalue > cfg.PValue {
+		return
+	}
+
+	*cps = append(*cps, ChangePoint{Index: offset + idx, PValue: pvalue})
+
+	detect(series[:idx], offset, cfg, rnd, cps)
+	detect(series[idx:], offset+idx, cfg, rnd, cps)
+}
+
+// cusum returns the split index maximizing the absolute cumulative sum of
+// the deviations from the mean, keeping at least minSize points on each side.
+func cusum(series []float64, minSize int) (int, float64) {
+	mean := stats.Mean(series)
+
+	var (
+		sum  float64
+		best float64
+		idx  int
+	)
+	for i := 0; i < len(series)-minSize; i++ {
+		sum += series[i] - mean
+		if i+1 < minSize {
+			continue
+		}
+		if s := math.Abs(sum); s > best {
+			best = s
+			idx = i + 1
+		}
+	}
+
+	return idx, best
+}
+
+// Step is a change point found in a history.
+type Step struct {
+	Metric string
+	Hash   git.CommitHash
+	Time   time.Time
+	Before float64
+	After  float64
+	// Change is the relative change in percent.
+	Change float64
+	PValue float64
+	// Regression is true if the metric got worse.
+	Regression bool
+}
+
+// Analyze detects the steps of every metric series of the records.
+// The records must be ordered.
+func Analyze(records []history.Record, cfg Config) []Step {
+	// quarantined records are excluded from the series.
+	records = history.Active(records)
+
+	var (
+		names  []string
+		series = make(map[string][]float64)
+		better = make(map[string]bool)
+	)
+	for _, r := range records {
+		for _, m := range history.Values(r) {
+			if _, ok := series[m.Name]; !ok {
+				names = append(names, m.Name)
+			}
+			series[m.Name] = append(series[m.Name], m.Value)
+			better[m.Name] = m.HigherIsBetter
+		}
+	}
+
+	var steps []Step
+	for _, name := range names {
+		s := series[name]
+		// skip the metrics missing in some records.
+		if len(s) != len(records) {
+			continue
+		}
+
+		for _, cp := range ChangePoints(s, cfg) {
+			e := records[cp.Index].Meta()
+			step := Step{
+				Metric: name,
+				Hash:   e.Hash,
+				Time:   e.Time,
+				Before: cp.Before,
+				After:  cp.After,
+				PValue: cp.PValue,
+			}
+			if cp.Before != 0 {
+				step.Change = (cp.After - cp.Before) / math.Abs(cp.Before) * 100
+			}
+			step.Regression = cp.After > cp.Before
+			if better[name] {
+				step.Regression = !step.Regression
+			}
+
+			steps = append(steps, step)
+		}
+	}
+
+	return steps
+}
+
+// WriteSteps writes a readable list of steps.
+func WriteSteps(w io.Writer, steps []Step) error {
+	if len(steps) == 0 {
+		_, err := fmt.Fprintln(w, "no significant change found")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "metric\tcommit\tdatetime\tbefore\tafter\tchange\tp-value\tkind")
+	for _, s := range steps {
+		kind := "improvement"
+		if s.Regression {
+			kind = "regression"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.6g\t%.6g\t%+.2f%%\t%.3f\t%s\n",
+			s.Metric, s.Hash, s.Time.Format(time.DateTime), s.Before, s.After, s.Change, s.PValue, kind)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,57 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analysis
+
+import (
+	"testing"
+)
+
+// noise returns a deterministic noise around v.
+func noise(v float64, n int) []float64 {
+	pattern := []float64{1, -2, 0.5, 1.5, -1, -0.5, 2, -1.5}
+
+	res := make([]float64, n)
+	for i := range res {
+		res[i] = v + pattern[i%len(pattern)]
+	}
+	return res
+}
+
+func TestChangePoints(t *testing.T) {
+	var series []float64
+	series = append(series, noise(100, 12)...)
+	series = append(series, noise(130, 10)...)
+	series = append(series, noise(90, 10)...)
+
+	cps := ChangePoints(series, Config{})
+	if len(cps) != 2 {
+		t.Fatalf("expected 2 change points, got %+v", cps)
+	}
+
+	if cps[0].Index != 12 || cps[1].Index != 22 {
+		t.Errorf("unexpected change points %+v", cps)
+	}
+
+	if cps[0].Before > 101 || cps[0].After < 129 {
+		t.Errorf("unexpected means %+v", cps[0])
+	}
+}
+
+func TestChangePointsFlat(t *testing.T) {
+	cps := ChangePoints(noise(100, 40), Config{})
+	if len(cps) != 0 {
+		t.Errorf("expected no change point, got %+v", cps)
+	}
+}
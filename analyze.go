@@ -0,0 +1,92 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/lightpanda-io/perf-fmt/analysis"
+	"github.com/lightpanda-io/perf-fmt/history"
+)
+
+// runAnalyze detects the change points of the source's history.
+func runAnalyze(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdAnalyze, flag.ExitOnError)
+
+	var (
+		pvalue       = flags.Float64("pvalue", analysis.DefaultPValue, "significance level of a change")
+		permutations = flags.Int("permutations", analysis.DefaultPermutations, "number of permutations of the significance test")
+		minSize      = flags.Int("min-size", analysis.DefaultMinSize, "minimum number of commits on each side of a change")
+		metric       = flags.String("metric", "", "analyze only this metric")
+	)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [analyze options] <source>\n", exec, CmdAnalyze)
+		fmt.Fprintf(stderr, "\nList the commits where a metric changed significantly in the whole history.\n")
+		fmt.Fprintf(stderr, "\nThe analyze options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	src, path, err := opts.lookupSource(args[0], history.PolicyFail)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+
+	records, err := pullRecords(ctx, st, opts.branchPath(path, opts.branch), src)
+	if err != nil {
+		return err
+	}
+
+	steps := analysis.Analyze(records, analysis.Config{
+		PValue:       *pvalue,
+		Permutations: *permutations,
+		MinSize:      *minSize,
+	})
+
+	if *metric != "" {
+		var filtered []analysis.Step
+		for _, s := range steps {
+			if s.Metric == *metric {
+				filtered = append(filtered, s)
+			}
+		}
+		steps = filtered
+	}
+
+	if err := analysis.WriteSteps(stdout, steps); err != nil {
+		return fmt.Errorf("write steps: %w", err)
+	}
+
+	return nil
+}
@@ -15,17 +15,484 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/lightpanda-io/perf-fmt/cf"
 	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/runner"
+	"github.com/lightpanda-io/perf-fmt/s3"
+	"github.com/lightpanda-io/perf-fmt/sources"
+	"github.com/lightpanda-io/perf-fmt/store"
 )
 
 type Append interface {
 	Append(ctx context.Context,
-		hash git.CommitHash, datetime time.Time,
+		e history.Entry,
 		out io.Writer,
 		all io.Reader, one io.Reader,
 	) error
 }
+
+// Source appends results and decodes the source's history.
+type Source = sources.Source
+
+// appendOptions contains the options of the append command.
+type appendOptions struct {
+	commitTime  string
+	parents     string
+	onDuplicate string
+	// dryRun prints the changes instead of pushing them.
+	dryRun bool
+	// meta contains the commit metadata given by the user, the branch is
+	// a global option.
+	meta git.Metadata
+	// env holds the runner labels, the machine fingerprint is gathered
+	// when appending.
+	env runner.Env
+}
+
+// newAppendOptions returns the default append options.
+// The runner environment is gathered by the append only.
+func newAppendOptions(getenv func(string) string) *appendOptions {
+	a := &appendOptions{
+		onDuplicate: string(history.PolicyFail),
+	}
+	a.env.Runner = getenv("RUNNER_NAME")
+
+	return a
+}
+
+// register declares the append flags, the current values are the defaults.
+func (a *appendOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&a.commitTime, "commit-time", a.commitTime, "commit date in RFC3339 format, overrides the repository one")
+	flags.StringVar(&a.parents, "parents", a.parents, "comma separated parent commits, overrides the repository ones")
+	flags.StringVar(&a.onDuplicate, "on-duplicate", a.onDuplicate, "policy when the commit already exists: fail, replace, keep or append-run")
+	flags.BoolVar(&a.dryRun, "dry-run", a.dryRun, "print the history changes and the keys to push without pushing")
+	flags.IntVar(&a.meta.PR, "pr", a.meta.PR, "commit's pull request number")
+	flags.StringVar(&a.meta.Subject, "subject", a.meta.Subject, "commit's subject")
+	flags.StringVar(&a.meta.Author, "author", a.meta.Author, "commit's author")
+	flags.StringVar(&a.meta.Tag, "tag", a.meta.Tag, "commit's tag")
+	flags.StringVar(&a.env.Runner, "runner", a.env.Runner, "runner label stored with the result, default to the RUNNER_NAME env var")
+	flags.StringVar(&a.env.Zig, "zig-version", a.env.Zig, "zig version stored with the result")
+	flags.StringVar(&a.env.V8, "v8-version", a.env.V8, "v8 version stored with the result")
+}
+
+// runAppend appends a result file to the source's history and stores the
+// single result next to it.
+func runAppend(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdAppend, flag.ExitOnError)
+
+	a := *opts.append
+	a.register(flags)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [append options] <source> <commit> <result.json>...\n", exec, CmdAppend)
+		fmt.Fprintf(stderr, "\nAppend the result to the source's history and store the single result.\n")
+		fmt.Fprintf(stderr, "The result - is read from stdin, the results can be glob patterns.\n")
+		fmt.Fprintf(stderr, "Several results are merged as runs of the commit and pushed at once.\n")
+		fmt.Fprintf(stderr, "\nThe commit metadata are read from the options, then the GitHub Actions\n")
+		fmt.Fprintf(stderr, "env vars GITHUB_SHA, GITHUB_REF and GITHUB_HEAD_REF, then the --repo repository.\n")
+		fmt.Fprintf(stderr, "The runner environment (cpu, memory, kernel, os) is read from /proc.\n")
+		fmt.Fprintf(stderr, "\nThe append options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) < 3 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	policy, err := history.ParsePolicy(a.onDuplicate)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	src, path, err := opts.lookupSource(args[0], policy)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	// the next results are merged as runs of the first one.
+	runs, _, err := opts.lookupSource(args[0], history.PolicyAppendRun)
+	if err != nil {
+		return err
+	}
+
+	e, err := opts.entry(ctx, args[1], time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if a.commitTime != "" {
+		t, err := time.Parse(time.RFC3339, a.commitTime)
+		if err != nil {
+			return fmt.Errorf("bad commit time: %w", err)
+		}
+		e.CommitTime = t.UTC()
+	}
+
+	if a.parents != "" {
+		if e.Parents, err = parseParents(a.parents); err != nil {
+			return err
+		}
+	}
+
+	// options take precedence over the CI env vars and the repository.
+	meta := a.meta
+	meta.Branch = opts.branch
+	e.Metadata = meta.Merge(git.MetadataFromEnv(opts.getenv, e.Hash)).Merge(e.Metadata)
+	env := runner.Gather()
+	env.Runner, env.Zig, env.V8 = a.env.Runner, a.env.Zig, a.env.V8
+	e.Env = &env
+
+	// If dev flag is active, use the `dev/` dir prefix.
+	// Non main branches results are stored in their own dir.
+	path = opts.branchPath(path, opts.branch)
+	if opts.dev {
+		fmt.Fprintf(stderr, "⚠️  Dev mode enabled, result will be stored in %q\n", path)
+	}
+
+	// read the results
+	results, err := readResults(args[2:], stdin)
+	if err != nil {
+		return err
+	}
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+	fio := st.Item(path+"/history.json", "application/json")
+
+	if a.dryRun {
+		fmt.Fprintf(stdout, "dry run, nothing is pushed.\n\n%s/history.json changes:\n", path)
+		first, err := dryRunAppend(ctx, fio, src, runs, policy, e, results, stdout)
+		if err != nil {
+			return err
+		}
+		if first == 0 {
+			fmt.Fprintf(stdout, "\n%s is kept, nothing would be pushed\n", e.Hash)
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "\nwould push %s/history.json\n", path)
+		for _, filename := range resultFilenames(e, first, len(results)) {
+			fmt.Fprintf(stdout, "would push %s/%s\n", path, filename)
+		}
+		info, err := opts.lookupInfo(args[0])
+		if err != nil {
+			return err
+		}
+		schemas, err := changedSchemas(ctx, st, path, info)
+		if err != nil {
+			return err
+		}
+		for _, f := range schemas {
+			fmt.Fprintf(stdout, "would push %s/%s\n", path, f.name)
+		}
+		if did := opts.cdnDistribution(); did != "" {
+			fmt.Fprintf(stdout, "would invalidate /%s in %s\n", store.ObjectKey(st, path+"/history.json"), did)
+		}
+		return nil
+	}
+
+	// append the results to the history.
+	first, err := appendHistory(ctx, fio, src, runs, policy, e, results)
+	if err != nil {
+		return err
+	}
+	if first == 0 {
+		fmt.Fprintf(stderr, "%s is kept, the results are ignored\n", e.Hash)
+		return nil
+	}
+
+	// push the single result files
+	for i, filename := range resultFilenames(e, first, len(results)) {
+		fio = st.Item(path+"/"+filename, "application/json")
+		if err := fio.Push(ctx, bytes.NewReader(results[i])); err != nil {
+			return fmt.Errorf("push single result : %w", err)
+		}
+	}
+
+	info, err := opts.lookupInfo(args[0])
+	if err != nil {
+		return err
+	}
+	if err := pushSchemas(ctx, st, path, info); err != nil {
+		return err
+	}
+
+	return invalidate(ctx, st, opts, path)
+}
+
+// invalidate optionally invalidates the CDN cache of the history stored in
+// the path of the store.
+func invalidate(ctx context.Context, st store.Store, opts options, path string) error {
+	did := opts.cdnDistribution()
+	if did == "" {
+		return nil
+	}
+
+	session, err := session.NewSession()
+	if err != nil {
+		return fmt.Errorf("new aws session: %w", err)
+	}
+
+	cf := cf.NewCloudFrontCache(session, did)
+	// Cloudfront requires an absolute path.
+	if err := cf.Invalidate(ctx, "/"+store.ObjectKey(st, path+"/history.json")); err != nil {
+		return fmt.Errorf("invalidate cache: %w", err)
+	}
+
+	return nil
+}
+
+const (
+	// maxAppendAttempts is the number of pull-append-push cycles tried
+	// before giving up on concurrent history modifications.
+	maxAppendAttempts = 5
+	appendRetryDelay  = 500 * time.Millisecond
+)
+
+// appendHistory pulls the history, appends the results and pushes the
+// history back with a versioned push. It returns the run of the first
+// result, see appendResults.
+// The whole cycle is retried if the history was modified in the meantime.
+func appendHistory(ctx context.Context,
+	item store.Item, src Source, runs Append,
+	policy history.Policy,
+	e history.Entry,
+	results [][]byte,
+) (int, error) {
+	for attempt := 1; ; attempt++ {
+		first, err := appendHistoryOnce(ctx, item, src, runs, policy, e, results)
+		if !errors.Is(err, s3.ErrConflict) || attempt >= maxAppendAttempts {
+			return first, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Duration(attempt) * appendRetryDelay):
+		}
+	}
+}
+
+func appendHistoryOnce(ctx context.Context,
+	item store.Item, src Source, runs Append,
+	policy history.Policy,
+	e history.Entry,
+	results [][]byte,
+) (int, error) {
+	// pull the all
+	all, version, err := item.PullVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("pull all files: %w", err)
+	}
+	defer all.Close()
+
+	var out bytes.Buffer
+
+	// append input to output
+	first, err := appendResults(ctx, src, runs, policy, e, &out, all, results)
+	if err != nil || first == 0 {
+		return first, err
+	}
+
+	// push output only if nobody pushed since our pull.
+	if err := item.PushVersion(ctx, &out, version); err != nil {
+		return 0, fmt.Errorf("push result: %w", err)
+	}
+
+	return first, nil
+}
+
+// appendResults appends the results to the all history into out.
+// The first result is appended by src with the policy, the next ones are
+// merged as runs by runs.
+// It returns the run of the first result in the commit's record: the
+// results of the append-run policy follow the existing runs. With the keep
+// policy, an existing commit ignores all the results and 0 is returned.
+func appendResults(ctx context.Context,
+	src Source, runs Append,
+	policy history.Policy,
+	e history.Entry,
+	out io.Writer,
+	all io.Reader, results [][]byte,
+) (int, error) {
+	cur, err := io.ReadAll(all)
+	if err != nil {
+		return 0, fmt.Errorf("read all files: %w", err)
+	}
+	records, err := src.Decode(bytes.NewReader(cur))
+	if err != nil {
+		return 0, fmt.Errorf("decode history: %w", err)
+	}
+
+	first := 1
+	i, err := history.Index(records, e.Hash)
+	switch {
+	case errors.Is(err, history.ErrNotFound):
+	case err != nil:
+		return 0, err
+	case policy == history.PolicyKeep:
+		return 0, nil
+	case policy == history.PolicyAppendRun:
+		first = max(records[i].Meta().Runs, 1) + 1
+	}
+
+	for i, res := range results {
+		var app Append = src
+		if i > 0 {
+			app = runs
+		}
+
+		var buf bytes.Buffer
+		if err := app.Append(ctx, e, &buf, bytes.NewReader(cur), bytes.NewReader(res)); err != nil {
+			return 0, fmt.Errorf("append result: %w", err)
+		}
+		cur = buf.Bytes()
+	}
+
+	if _, err := out.Write(cur); err != nil {
+		return 0, fmt.Errorf("copy result: %w", err)
+	}
+
+	return first, nil
+}
+
+// readResults reads the results files. The - file is read from stdin and
+// the glob patterns not naming an existing file are expanded.
+func readResults(names []string, stdin io.Reader) ([][]byte, error) {
+	var (
+		results   [][]byte
+		stdinRead bool
+	)
+	for _, name := range names {
+		if name == "-" {
+			if stdinRead {
+				return nil, errors.New("stdin can be read only once")
+			}
+			stdinRead = true
+
+			b, err := io.ReadAll(stdin)
+			if err != nil {
+				return nil, fmt.Errorf("read stdin: %w", err)
+			}
+			results = append(results, b)
+			continue
+		}
+
+		// an existing file is read as is, even if its name looks like a
+		// pattern.
+		files := []string{name}
+		if _, err := os.Stat(name); errors.Is(err, fs.ErrNotExist) && strings.ContainsAny(name, "*?[") {
+			var err error
+			if files, err = filepath.Glob(name); err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", name, err)
+			}
+			if len(files) == 0 {
+				return nil, fmt.Errorf("no file matches %q", name)
+			}
+		}
+
+		for _, f := range files {
+			b, err := os.ReadFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("read input file: %w", err)
+			}
+			results = append(results, b)
+		}
+	}
+
+	return results, nil
+}
+
+// resultFilenames returns the storage file names of the commit's n single
+// results, numbered from the first run.
+func resultFilenames(e history.Entry, first, n int) []string {
+	var filenames []string
+	for run := first; run < first+n; run++ {
+		filenames = append(filenames, history.ResultName{Time: e.Time, Hash: e.Hash, Run: run}.String())
+	}
+
+	return filenames
+}
+
+// dryRunAppend appends the results to the pulled history and writes the
+// changes to w, nothing is pushed. It returns the run of the first result,
+// see appendResults.
+func dryRunAppend(ctx context.Context,
+	item store.Item, src Source, runs Append,
+	policy history.Policy,
+	e history.Entry,
+	results [][]byte,
+	w io.Writer,
+) (int, error) {
+	r, err := item.Pull(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("pull all files: %w", err)
+	}
+	defer r.Close()
+
+	all, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("read all files: %w", err)
+	}
+
+	var out bytes.Buffer
+	first, err := appendResults(ctx, src, runs, policy, e, &out, bytes.NewReader(all), results)
+	if err != nil || first == 0 {
+		return first, err
+	}
+
+	old, err := src.Decode(bytes.NewReader(all))
+	if err != nil {
+		return 0, fmt.Errorf("decode history: %w", err)
+	}
+	new, err := src.Decode(&out)
+	if err != nil {
+		return 0, fmt.Errorf("decode new history: %w", err)
+	}
+
+	changes, err := history.Diff(old, new)
+	if err != nil {
+		return 0, err
+	}
+
+	return first, history.WriteDiff(w, changes)
+}
+
+// pullRecords pulls and decodes the source's history stored in the dir.
+func pullRecords(ctx context.Context, st store.Store, dir string, src Source) ([]history.Record, error) {
+	all, err := st.Item(dir+"/history.json", "application/json").Pull(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pull all files: %w", err)
+	}
+	defer all.Close()
+
+	records, err := src.Decode(all)
+	if err != nil {
+		return nil, fmt.Errorf("decode history: %w", err)
+	}
+
+	return records, nil
+}
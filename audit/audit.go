@@ -0,0 +1,96 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records the manual changes of the histories in a JSON lines
+// log stored next to each history.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+)
+
+type Action string
+
+const (
+	ActionDelete     Action = "delete"
+	ActionQuarantine Action = "quarantine"
+	ActionRelease    Action = "release"
+)
+
+// Event is a line of the audit log.
+type Event struct {
+	Time   time.Time      `json:"datetime"`
+	Action Action         `json:"action"`
+	Source string         `json:"source"`
+	Commit git.CommitHash `json:"commit"`
+	Reason string         `json:"reason,omitempty"`
+	Actor  string         `json:"actor,omitempty"`
+	// Record is the deleted record, it allows to restore it.
+	Record json.RawMessage `json:"record,omitempty"`
+}
+
+// Append copies the log into w and appends the event.
+func Append(w io.Writer, log io.Reader, ev Event) error {
+	if _, err := io.Copy(w, log); err != nil {
+		return fmt.Errorf("copy audit log: %w", err)
+	}
+
+	if err := json.NewEncoder(w).Encode(ev); err != nil {
+		return fmt.Errorf("encode audit event: %w", err)
+	}
+
+	return nil
+}
+
+// Decode decodes the events of the log.
+func Decode(log io.Reader) ([]Event, error) {
+	var events []Event
+
+	s := bufio.NewScanner(log)
+	s.Buffer(nil, 16*1024*1024)
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		var ev Event
+		if err := json.Unmarshal(s.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("decode audit event: %w", err)
+		}
+		events = append(events, ev)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+
+	return events, nil
+}
+
+// Deleted returns the last deletion time of the deleted commits.
+func Deleted(events []Event) map[git.CommitHash]time.Time {
+	deleted := make(map[git.CommitHash]time.Time)
+	for _, ev := range events {
+		if ev.Action == ActionDelete && ev.Time.After(deleted[ev.Commit]) {
+			deleted[ev.Commit] = ev.Time
+		}
+	}
+
+	return deleted
+}
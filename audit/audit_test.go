@@ -0,0 +1,50 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestAppend(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var log []byte
+	for _, ev := range []Event{
+		{Time: t0, Action: ActionQuarantine, Commit: "aaaaaaa", Reason: "noisy runner"},
+		{Time: t0.Add(time.Hour), Action: ActionDelete, Commit: "bbbbbbb", Record: []byte(`{"commit":"bbbbbbb"}`)},
+	} {
+		var buf bytes.Buffer
+		if err := Append(&buf, bytes.NewReader(log), ev); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		log = buf.Bytes()
+	}
+
+	events, err := Decode(bytes.NewReader(log))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(events) != 2 || events[0].Reason != "noisy runner" || string(events[1].Record) != `{"commit":"bbbbbbb"}` {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	deleted := Deleted(events)
+	if len(deleted) != 1 || !deleted["bbbbbbb"].Equal(t0.Add(time.Hour)) {
+		t.Errorf("unexpected deleted commits %v", deleted)
+	}
+}
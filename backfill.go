@@ -0,0 +1,276 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/sources"
+	"github.com/lightpanda-io/perf-fmt/store"
+)
+
+// runBackfill merges the raw results of a dir into the source's history and
+// stores them next to it.
+func runBackfill(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdBackfill, flag.ExitOnError)
+
+	var (
+		onDuplicate = flags.String("on-duplicate", string(history.PolicyReplace), "policy when the commit already exists: fail, replace, keep or append-run")
+		concurrency = flags.Int("concurrency", 8, "number of single results uploaded concurrently")
+	)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [backfill options] <source> <dir>\n", exec, CmdBackfill)
+		fmt.Fprintf(stderr, "\nBackfill the source's history, or the --branch one, with the raw results of the dir.\n")
+		fmt.Fprintf(stderr, "The files are named <date>_<time>_<hash>..., a later result of a commit\n")
+		fmt.Fprintf(stderr, "replaces the existing one. The results are also uploaded next to the history.\n")
+		fmt.Fprintf(stderr, "\nThe backfill options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	policy, err := history.ParsePolicy(*onDuplicate)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	src, path, err := opts.lookupSource(args[0], policy)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+	// the next runs of a commit are merged as runs.
+	runs, _, err := opts.lookupSource(args[0], history.PolicyAppendRun)
+	if err != nil {
+		return err
+	}
+	info, err := opts.lookupInfo(args[0])
+	if err != nil {
+		return err
+	}
+
+	path = opts.branchPath(path, opts.branch)
+
+	results, err := readDir(args[1], info, stderr)
+	if err != nil {
+		return err
+	}
+
+	// the entries' metadata are read from the repository.
+	entries := make([]history.Entry, len(results))
+	for i, res := range results {
+		if entries[i], err = rebuildEntry(ctx, opts, nil, res.name); err != nil {
+			return err
+		}
+	}
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+
+	// merged are the results merged into the history, the keep policy
+	// ignores the first runs of the existing commits and the runs of the
+	// ignored commits.
+	var merged []result
+	err = updateItem(ctx, st.Item(path+"/history.json", "application/json"), func(all []byte) ([]byte, error) {
+		records, err := src.Decode(bytes.NewReader(all))
+		if err != nil {
+			return nil, fmt.Errorf("decode history: %w", err)
+		}
+
+		merged = nil
+		kept := make(map[git.CommitHash]bool)
+		for i, res := range results {
+			if policy == history.PolicyKeep {
+				if res.name.Run == 1 {
+					_, err := history.Index(records, res.name.Hash)
+					kept[res.name.Hash] = err == nil
+				}
+				if kept[res.name.Hash] {
+					continue
+				}
+			}
+			merged = append(merged, res)
+
+			var app Append = src
+			if res.name.Run > 1 {
+				app = runs
+			}
+
+			var buf bytes.Buffer
+			if err := app.Append(ctx, entries[i], &buf, bytes.NewReader(all), bytes.NewReader(res.data)); err != nil {
+				return nil, fmt.Errorf("append %s: %w", res.name, err)
+			}
+			all = buf.Bytes()
+		}
+		return all, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// upload all individual files
+	if err := pushResults(ctx, st, path, uniqueResults(merged, policy), *concurrency); err != nil {
+		return err
+	}
+	if err := pushSchemas(ctx, st, path, info); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "%d results merged into %s/history.json\n", len(merged), path)
+
+	return invalidate(ctx, st, opts, path)
+}
+
+// result is a raw result file to backfill.
+type result struct {
+	name history.ResultName
+	// data is the source's JSON input.
+	data []byte
+}
+
+// readDir reads the raw results of the dir ordered by date, commit and run.
+func readDir(dirname string, info sources.Info, stderr io.Writer) ([]result, error) {
+	files, err := os.ReadDir(dirname)
+	if err != nil {
+		return nil, fmt.Errorf("opendir: %w", err)
+	}
+
+	var results []result
+	for _, file := range files {
+		// ignore subdirs
+		if file.IsDir() {
+			continue
+		}
+		fmt.Fprintln(stderr, file.Name())
+
+		name, err := history.ParseResultName(file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("parse file name: %w", err)
+		}
+
+		b, err := os.ReadFile(filepath.Join(dirname, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("readfile: %w", err)
+		}
+
+		data, err := info.Read(file.Name(), b)
+		if err != nil {
+			return nil, fmt.Errorf("parse file %s: %w", file.Name(), err)
+		}
+
+		results = append(results, result{name: name, data: data})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].name.Before(results[j].name)
+	})
+
+	return results, nil
+}
+
+// uniqueResults returns the results with distinct names, as kept by the
+// merge. The file names' non numeric suffixes are ignored, so several files
+// can have the same name: the first one is kept with the keep policy, the
+// last one with the other policies and they are all numbered as next runs
+// with the append-run policy.
+func uniqueResults(results []result, policy history.Policy) []result {
+	index := make(map[history.ResultName]int, len(results))
+
+	var unique []result
+	for _, res := range results {
+		i, ok := index[res.name]
+		if ok && policy == history.PolicyAppendRun {
+			for ok {
+				res.name.Run++
+				_, ok = index[res.name]
+			}
+		}
+		switch {
+		case !ok:
+			index[res.name] = len(unique)
+			unique = append(unique, res)
+		case policy != history.PolicyKeep:
+			unique[i] = res
+		}
+	}
+
+	return unique
+}
+
+// pushResults uploads the single results concurrently.
+func pushResults(ctx context.Context, st store.Store, path string, results []result, concurrency int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+		sem  = make(chan struct{}, max(1, concurrency))
+	)
+
+	for _, res := range results {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(res result) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			fio := st.Item(path+"/"+res.name.String(), "application/json")
+			if perr := fio.Push(ctx, bytes.NewReader(res.data)); perr != nil {
+				once.Do(func() {
+					err = fmt.Errorf("push single result %s: %w", res.name, perr)
+					cancel()
+				})
+			}
+		}(res)
+	}
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
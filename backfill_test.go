@@ -0,0 +1,109 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lightpanda-io/perf-fmt/cdp"
+	"github.com/lightpanda-io/perf-fmt/history"
+)
+
+func TestRunBackfill(t *testing.T) {
+	storeDir, storeURL := newFileStore(t)
+
+	dir := t.TempDir()
+	for name, avg := range map[string]int{
+		"2024-01-01_10-00_aaaaaaa.json":   10,
+		"2024-01-01_10-00_aaaaaaa_2.json": 12,
+		"2024-01-02_10-00_bbbbbbb.json":   20,
+		// a later result replaces the commit's one.
+		"2024-01-03_10-00_bbbbbbb_cdp.json": 30,
+	} {
+		writeFile(t, dir, name, cdpResult(avg))
+	}
+
+	err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, CmdBackfill, "cdp", dir}, noEnv, nil, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(storeDir, "cdp", "history.json"))
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+
+	all, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+
+	if len(all) != 2 || all[0].Hash != "aaaaaaa" || all[0].Runs != 2 || all[1].DurationAVG != 30 {
+		t.Fatalf("unexpected history %+v", all)
+	}
+
+	files, err := filepath.Glob(filepath.Join(storeDir, "cdp", "2024-*.json"))
+	if err != nil || len(files) != 4 {
+		t.Errorf("unexpected single results %v", files)
+	}
+
+	// keep ignores the results of the existing commits.
+	keepDir := t.TempDir()
+	writeFile(t, keepDir, "2024-01-04_10-00_aaaaaaa.json", cdpResult(50))
+	err = run(context.Background(), []string{"perf-fmt", "--store", storeURL, CmdBackfill, "--on-duplicate", "keep", "cdp", keepDir}, noEnv, nil, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("run keep: %v", err)
+	}
+	if kept, err := os.ReadFile(filepath.Join(storeDir, "cdp", "history.json")); err != nil || !bytes.Equal(kept, b) {
+		t.Errorf("unexpected kept history %s", kept)
+	}
+	if _, err := os.Stat(filepath.Join(storeDir, "cdp", "2024-01-04_10-00_aaaaaaa.json")); !os.IsNotExist(err) {
+		t.Errorf("expected the kept result not uploaded, got %v", err)
+	}
+}
+
+func TestUniqueResults(t *testing.T) {
+	name := history.ResultName{Hash: "aaaaaaa", Run: 1}
+	results := []result{
+		{name: name, data: []byte("a")},
+		{name: name, data: []byte("b")},
+		{name: history.ResultName{Hash: "aaaaaaa", Run: 2}, data: []byte("c")},
+	}
+
+	for _, tc := range []struct {
+		policy   history.Policy
+		expected string
+	}{
+		{policy: history.PolicyReplace, expected: "aaaaaaa.json:b aaaaaaa_2.json:c"},
+		{policy: history.PolicyKeep, expected: "aaaaaaa.json:a aaaaaaa_2.json:c"},
+		{policy: history.PolicyAppendRun, expected: "aaaaaaa.json:a aaaaaaa_2.json:b aaaaaaa_3.json:c"},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			var got []string
+			for _, res := range uniqueResults(results, tc.policy) {
+				got = append(got, strings.TrimPrefix(res.name.String(), "0001-01-01_00-00_")+":"+string(res.data))
+			}
+			if s := strings.Join(got, " "); s != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, s)
+			}
+		})
+	}
+}
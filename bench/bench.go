@@ -14,6 +14,8 @@
 
 package bench
 
+import "github.com/lightpanda-io/perf-fmt/history"
+
 type InItem struct {
 	Duration  int `json:"duration"`
 	AllocSize int `json:"alloc_size"`
@@ -23,7 +25,7 @@ type InItem struct {
 }
 
 type InResult struct {
-	Name  string `json:"name"`
+	Name  string `json:"name" schema:"required"`
 	Bench InItem `json:"bench"`
 }
 
@@ -34,3 +36,14 @@ type OutItem struct {
 	ReallocNb int `json:"realloc_nb"`
 	FreeNb    int `json:"free"`
 }
+
+// Metrics returns the item's values as metrics prefixed by name.
+func (i OutItem) Metrics(name string) []history.Metric {
+	return []history.Metric{
+		{Name: name + ".duration", Value: float64(i.Duration)},
+		{Name: name + ".alloc_size", Value: float64(i.AllocSize)},
+		{Name: name + ".alloc_nb", Value: float64(i.AllocNb)},
+		{Name: name + ".realloc_nb", Value: float64(i.ReallocNb)},
+		{Name: name + ".free", Value: float64(i.FreeNb)},
+	}
+}
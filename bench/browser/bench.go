@@ -16,20 +16,16 @@ package browser
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"sort"
-	"time"
 
 	"github.com/lightpanda-io/perf-fmt/bench"
-	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/sources"
 )
 
 type OutResult struct {
-	Hash git.CommitHash `json:"commit"`
-	Time time.Time      `json:"datetime"`
+	history.Entry
 	Data struct {
 		Browser bench.OutItem `json:"browser"`
 		Libdom  bench.OutItem `json:"libdom"`
@@ -38,41 +34,51 @@ type OutResult struct {
 	} `json:"data"`
 }
 
-type Append struct{}
+func (r *OutResult) Metrics() []history.Metric {
+	var metrics []history.Metric
+	metrics = append(metrics, r.Data.Browser.Metrics("browser")...)
+	metrics = append(metrics, r.Data.Libdom.Metrics("libdom")...)
+	metrics = append(metrics, r.Data.V8.Metrics("v8")...)
+	metrics = append(metrics, r.Data.Main.Metrics("main")...)
+
+	return metrics
+}
+
+// Name is the source's registered name.
+const Name = "bench-browser"
+
+func init() {
+	sources.Register(sources.Info{
+		Name:        Name,
+		Description: "lightpanda browser test benchmark json result.",
+		Path:        "bench/browser",
+		In:          []bench.InResult{},
+		Out:         &OutResult{},
+		New:         func(p history.Policy) sources.Source { return &Append{OnDuplicate: p} },
+	})
+}
+
+type Append struct {
+	// OnDuplicate is the policy applied when the commit already exists.
+	OnDuplicate history.Policy
+}
 
 func (a *Append) Append(
 	ctx context.Context,
-	hash git.CommitHash, datetime time.Time,
+	e history.Entry,
 	out io.Writer,
 	all io.Reader, one io.Reader,
 ) error {
-	// decode one input
-	var inr []bench.InResult
-	dec := json.NewDecoder(one)
-
-	if err := dec.Decode(&inr); err != nil {
-		return fmt.Errorf("decode one: %w", err)
-	}
-
-	// decode all input
-	var allres []OutResult
-	dec = json.NewDecoder(all)
-
-	if err := dec.Decode(&allres); err != nil && !errors.Is(err, io.EOF) {
-		return fmt.Errorf("decode all: %w", err)
-	}
+	return history.Append(e, a.OnDuplicate, out, all, one, convert)
+}
 
-	// search if the commit already exists in the all results to avoid duplication.
-	for _, v := range allres {
-		if hash == v.Hash {
-			return errors.New("hash exists")
-		}
-	}
+// Decode decodes the history.
+func (a *Append) Decode(r io.Reader) ([]history.Record, error) {
+	return history.DecodeRecords[*OutResult](r)
+}
 
-	outres := OutResult{
-		Hash: hash,
-		Time: datetime,
-	}
+func convert(inr []bench.InResult, e history.Entry) (*OutResult, error) {
+	outres := &OutResult{Entry: e}
 
 	for _, v := range inr {
 		switch v.Name {
@@ -85,22 +91,9 @@ func (a *Append) Append(
 		case "main":
 			outres.Data.Main = bench.OutItem(v.Bench)
 		default:
-			return fmt.Errorf("unhandled bench result: %s", v.Name)
+			return nil, fmt.Errorf("unhandled bench result: %s", v.Name)
 		}
 	}
 
-	allres = append(allres, outres)
-
-	// reorder slice
-	sort.Slice(allres, func(i, j int) bool {
-		return allres[i].Time.Before(allres[j].Time)
-	})
-
-	// encode output
-	enc := json.NewEncoder(out)
-	if err := enc.Encode(allres); err != nil {
-		return fmt.Errorf("encode out: %w", err)
-	}
-
-	return nil
+	return outres, nil
 }
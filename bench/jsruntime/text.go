@@ -16,8 +16,10 @@ package jsruntime
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
@@ -25,6 +27,7 @@ import (
 
 	"github.com/lightpanda-io/perf-fmt/bench"
 	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
 )
 
 var (
@@ -39,8 +42,7 @@ func ParseTxtData(filename string, data []byte) (OutResult, error) {
 	}
 
 	res := OutResult{
-		Hash: commit,
-		Time: datetime,
+		Entry: history.Entry{Hash: commit, Time: datetime},
 	}
 
 	var (
@@ -122,6 +124,29 @@ func parseLine(data []byte) (bench.OutItem, error) {
 	}, nil
 }
 
+// ReadRaw returns the JSON input of a raw result file.
+// The legacy .txt outputs are converted, other files are returned as is.
+func ReadRaw(filename string, data []byte) ([]byte, error) {
+	if path.Ext(filename) != ".txt" {
+		return data, nil
+	}
+
+	out, err := ParseTxtData(filename, data)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal([]bench.InResult{
+		{Name: "With Isolate", Bench: bench.InItem(out.Data.WithIsolate)},
+		{Name: "Without Isolate", Bench: bench.InItem(out.Data.WithoutIsolate)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("json encode: %w", err)
+	}
+
+	return b, nil
+}
+
 func parseTxtName(filename string) (time.Time, git.CommitHash, error) {
 	strdate, rest, ok := strings.Cut(filename, "_")
 	if !ok {
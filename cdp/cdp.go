@@ -16,14 +16,10 @@ package cdp
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
-	"fmt"
 	"io"
-	"sort"
-	"time"
 
-	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/sources"
 )
 
 type InResult struct {
@@ -34,66 +30,61 @@ type InResult struct {
 }
 
 type OutResult struct {
-	Hash          git.CommitHash `json:"commit"`
-	Time          time.Time      `json:"datetime"`
-	DurationTotal int            `json:"duration_total"`
-	DurationAVG   int            `json:"duration_avg"`
-	MemPeak       int            `json:"mem_peak"`
-	CGMemPeak     int            `json:"cg_mem_peak"`
+	history.Entry
+	DurationTotal int `json:"duration_total"`
+	DurationAVG   int `json:"duration_avg"`
+	MemPeak       int `json:"mem_peak"`
+	CGMemPeak     int `json:"cg_mem_peak"`
 }
 
-type Append struct{}
+func (r *OutResult) Metrics() []history.Metric {
+	return []history.Metric{
+		{Name: "duration_total", Value: float64(r.DurationTotal)},
+		{Name: "duration_avg", Value: float64(r.DurationAVG)},
+		{Name: "mem_peak", Value: float64(r.MemPeak)},
+		{Name: "cg_mem_peak", Value: float64(r.CGMemPeak)},
+	}
+}
+
+// Name is the source's registered name.
+const Name = "cdp"
+
+func init() {
+	sources.Register(sources.Info{
+		Name:        Name,
+		Description: "lightpanda browser CDP benchmark json result.",
+		Path:        "cdp",
+		In:          InResult{},
+		Out:         &OutResult{},
+		New:         func(p history.Policy) sources.Source { return &Append{OnDuplicate: p} },
+	})
+}
+
+type Append struct {
+	// OnDuplicate is the policy applied when the commit already exists.
+	OnDuplicate history.Policy
+}
 
 func (a *Append) Append(
 	ctx context.Context,
-	hash git.CommitHash, datetime time.Time,
+	e history.Entry,
 	out io.Writer,
 	all io.Reader, one io.Reader,
 ) error {
-	// decode one input
-	var inr InResult
-	dec := json.NewDecoder(one)
-
-	if err := dec.Decode(&inr); err != nil {
-		return fmt.Errorf("decode one: %w", err)
-	}
-
-	// decode all input
-	var allres []OutResult
-	dec = json.NewDecoder(all)
-
-	if err := dec.Decode(&allres); err != nil && !errors.Is(err, io.EOF) {
-		return fmt.Errorf("decode all: %w", err)
-	}
+	return history.Append(e, a.OnDuplicate, out, all, one, convert)
+}
 
-	// search if the commit already exists in the all results to avoid duplication.
-	for _, v := range allres {
-		if hash == v.Hash {
-			return errors.New("hash exists")
-		}
-	}
+// Decode decodes the history.
+func (a *Append) Decode(r io.Reader) ([]history.Record, error) {
+	return history.DecodeRecords[*OutResult](r)
+}
 
-	outres := OutResult{
-		Hash:          hash,
-		Time:          datetime,
+func convert(inr InResult, e history.Entry) (*OutResult, error) {
+	return &OutResult{
+		Entry:         e,
 		DurationTotal: inr.DurationTotal,
 		DurationAVG:   inr.DurationAVG,
 		MemPeak:       inr.MemPeak,
 		CGMemPeak:     inr.CGMemPeak,
-	}
-
-	allres = append(allres, outres)
-
-	// reorder slice
-	sort.Slice(allres, func(i, j int) bool {
-		return allres[i].Time.Before(allres[j].Time)
-	})
-
-	// encode output
-	enc := json.NewEncoder(out)
-	if err := enc.Encode(allres); err != nil {
-		return fmt.Errorf("encode out: %w", err)
-	}
-
-	return nil
+	}, nil
 }
@@ -0,0 +1,173 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lightpanda-io/perf-fmt/compare"
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/regression"
+)
+
+var errRegression = errors.New("regression detected")
+
+// runCheck compares a commit's result with the previous results of the
+// source's history.
+func runCheck(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdCheck, flag.ExitOnError)
+
+	// the configured values are the defaults.
+	dfltBaseline, dfltThreshold := regression.DefaultBaseline, regression.DefaultThreshold
+	if opts.cfg.Baseline > 0 {
+		dfltBaseline = opts.cfg.Baseline
+	}
+	if opts.cfg.Threshold > 0 {
+		dfltThreshold = opts.cfg.Threshold
+	}
+
+	var (
+		baseline   = flags.Int("baseline", dfltBaseline, "number of previous commits used as baseline")
+		threshold  = flags.Float64("threshold", dfltThreshold, "maximum degradation in percent")
+		thresholds = metricThresholds{}
+	)
+	flags.Var(thresholds, "metric-threshold", "per metric maximum degradation, e.g. duration_avg=5, can be repeated, overrides the configured ones")
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [check options] <source> <commit>\n", exec, CmdCheck)
+		fmt.Fprintf(stderr, "\nCompare the commit's result with the median of the previous commits.\n")
+		fmt.Fprintf(stderr, "The result of a --branch commit is compared with the main branch latest commits.\n")
+		fmt.Fprintf(stderr, "The command fails if a metric degradation exceeds its threshold.\n")
+		fmt.Fprintf(stderr, "\nThe check options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	src, path, err := opts.lookupSource(args[0], history.PolicyFail)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	hash, err := opts.commit(ctx, args[1])
+	if err != nil {
+		return err
+	}
+
+	for name, v := range opts.cfg.Source(args[0]).Thresholds {
+		if _, ok := thresholds[name]; !ok {
+			thresholds[name] = v
+		}
+	}
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+
+	records, err := pullRecords(ctx, st, opts.branchPath(path, opts.branch), src)
+	if err != nil {
+		return err
+	}
+
+	// a branch's commit is compared with the main history baseline.
+	if !opts.isMain(opts.branch) {
+		rec, err := compare.Find(records, hash)
+		if err != nil {
+			return fmt.Errorf("check: %w", err)
+		}
+
+		main, err := pullRecords(ctx, st, opts.branchPath(path, ""), src)
+		if err != nil {
+			return err
+		}
+
+		records = append(excludeCommit(main, hash), rec)
+	}
+
+	report, err := regression.Check(records, hash, regression.Config{
+		Baseline:   *baseline,
+		Threshold:  *threshold,
+		Thresholds: thresholds,
+	})
+	if err != nil {
+		return fmt.Errorf("check: %w", err)
+	}
+	if err := opts.checkEnv(report.EnvDiff); err != nil {
+		return err
+	}
+
+	if err := report.Write(stdout); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+
+	if report.Regressed() {
+		return errRegression
+	}
+
+	return nil
+}
+
+// excludeCommit returns the records without the hash's one.
+func excludeCommit(records []history.Record, hash git.CommitHash) []history.Record {
+	var res []history.Record
+	for _, v := range records {
+		if !v.Meta().Hash.Matches(hash) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// metricThresholds is a repeatable name=percent flag.
+type metricThresholds map[string]float64
+
+func (m metricThresholds) String() string {
+	var s []string
+	for k, v := range m {
+		s = append(s, fmt.Sprintf("%s=%g", k, v))
+	}
+	return strings.Join(s, ",")
+}
+
+func (m metricThresholds) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return errors.New("expected name=percent")
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("bad threshold: %w", err)
+	}
+
+	m[name] = v
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/lightpanda-io/perf-fmt/compare"
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/store"
+)
+
+// runCompare prints the metrics deltas between two commits of a source.
+func runCompare(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdCompare, flag.ExitOnError)
+
+	var (
+		format = flags.String("format", string(compare.FormatText), "output format: text, markdown or json")
+	)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [compare options] <source> <commitA> <commitB>\n", exec, CmdCompare)
+		fmt.Fprintf(stderr, "\nPrint the metrics of the two commits with the deltas from A to B.\n")
+		fmt.Fprintf(stderr, "With --branch, the commits are searched in the branch history, then in the main one.\n")
+		fmt.Fprintf(stderr, "\nThe compare options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) != 3 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	f, err := compare.ParseFormat(*format)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	src, path, err := opts.lookupSource(args[0], history.PolicyFail)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	a, err := opts.commit(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	b, err := opts.commit(ctx, args[2])
+	if err != nil {
+		return err
+	}
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+
+	c, err := compareCommits(ctx, st, opts, src, path, a, b)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(stdout, f)
+}
+
+// compareCommits compares the commits a and b of the source's history.
+// A branch's commit can be compared with a main branch commit.
+func compareCommits(ctx context.Context, st store.Store, opts options, src Source, path string, a, b git.CommitHash) (compare.Comparison, error) {
+	records, err := pullRecords(ctx, st, opts.branchPath(path, opts.branch), src)
+	if err != nil {
+		return compare.Comparison{}, err
+	}
+
+	if !opts.isMain(opts.branch) {
+		main, err := pullRecords(ctx, st, opts.branchPath(path, ""), src)
+		if err != nil {
+			return compare.Comparison{}, err
+		}
+
+		records = append(records, main...)
+	}
+
+	c, err := compare.Compare(records, a, b)
+	if err != nil {
+		return compare.Comparison{}, fmt.Errorf("compare: %w", err)
+	}
+	if err := opts.checkEnv(c.EnvDiff); err != nil {
+		return compare.Comparison{}, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compare compares the metrics of two history records.
+package compare
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/runner"
+)
+
+var (
+	// ErrNotFound is the history's error of a commit without record.
+	ErrNotFound  = history.ErrNotFound
+	ErrBadFormat = errors.New("bad output format")
+)
+
+type Format string
+
+const (
+	FormatText     Format = "text"
+	FormatMarkdown Format = "markdown"
+	FormatJSON     Format = "json"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatText, FormatMarkdown, FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrBadFormat, s)
+	}
+}
+
+// Row is the comparison of one metric.
+type Row struct {
+	Metric string  `json:"metric"`
+	A      float64 `json:"a"`
+	B      float64 `json:"b"`
+	Delta  float64 `json:"delta"`
+	// Change is the relative change from A to B in percent.
+	// It's nil if A is zero.
+	Change         *float64 `json:"change,omitempty"`
+	HigherIsBetter bool     `json:"higher_is_better,omitempty"`
+}
+
+// Worse returns true if B is worse than A.
+func (r Row) Worse() bool {
+	if r.HigherIsBetter {
+		return r.Delta < 0
+	}
+	return r.Delta > 0
+}
+
+type Comparison struct {
+	A    git.CommitHash `json:"a"`
+	B    git.CommitHash `json:"b"`
+	Rows []Row          `json:"metrics"`
+	// EnvDiff lists the differences between the runner environments of
+	// the records, the results may not be comparable.
+	EnvDiff []string `json:"env_diff,omitempty"`
+}
+
+// Find returns the record of the hash.
+func Find(records []history.Record, hash git.CommitHash) (history.Record, error) {
+	i, err := history.Index(records, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return records[i], nil
+}
+
+// Compare compares the records of the hashes a and b.
+func Compare(records []history.Record, a, b git.CommitHash) (Comparison, error) {
+	ra, err := Find(records, a)
+	if err != nil {
+		return Comparison{}, err
+	}
+	rb, err := Find(records, b)
+	if err != nil {
+		return Comparison{}, err
+	}
+
+	return Records(ra, rb), nil
+}
+
+// Records compares the record a with the record b.
+func Records(a, b history.Record) Comparison {
+	c := Comparison{
+		A:       a.Meta().Hash,
+		B:       b.Meta().Hash,
+		EnvDiff: runner.Diff(a.Meta().Env, b.Meta().Env),
+	}
+
+	values := make(map[string]float64)
+	for _, m := range history.Values(a) {
+		values[m.Name] = m.Value
+	}
+
+	for _, m := range history.Values(b) {
+		va, ok := values[m.Name]
+		if !ok {
+			continue
+		}
+
+		row := Row{
+			Metric:         m.Name,
+			A:              va,
+			B:              m.Value,
+			Delta:          m.Value - va,
+			HigherIsBetter: m.HigherIsBetter,
+		}
+		if va != 0 {
+			change := row.Delta / math.Abs(va) * 100
+			row.Change = &change
+		}
+
+		c.Rows = append(c.Rows, row)
+	}
+
+	return c
+}
+
+// Write writes the comparison in the format f.
+func (c Comparison) Write(w io.Writer, f Format) error {
+	switch f {
+	case FormatText:
+		return c.WriteText(w)
+	case FormatMarkdown:
+		return c.WriteMarkdown(w)
+	case FormatJSON:
+		return c.WriteJSON(w)
+	default:
+		return fmt.Errorf("%w: %q", ErrBadFormat, f)
+	}
+}
+
+func (c Comparison) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "metric\t%s\t%s\tdelta\tchange\n", c.A, c.B)
+	for _, r := range c.Rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			r.Metric, FormatValue(r.A), FormatValue(r.B), FormatDelta(r.Delta), FormatChange(r.Change))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, d := range c.EnvDiff {
+		fmt.Fprintf(w, "warning: environment differs: %s\n", d)
+	}
+
+	return nil
+}
+
+func (c Comparison) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "| metric | %s | %s | delta | change |\n", c.A, c.B)
+	fmt.Fprintf(&b, "|---|---:|---:|---:|---:|\n")
+	for _, r := range c.Rows {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n",
+			r.Metric, FormatValue(r.A), FormatValue(r.B), FormatDelta(r.Delta), FormatChange(r.Change))
+	}
+	if len(c.EnvDiff) > 0 {
+		fmt.Fprintf(&b, "\n> [!WARNING]\n> The runner environments differ:\n")
+		for _, d := range c.EnvDiff {
+			fmt.Fprintf(&b, "> - %s\n", d)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (c Comparison) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(c); err != nil {
+		return fmt.Errorf("encode comparison: %w", err)
+	}
+
+	return nil
+}
+
+func FormatValue(v float64) string {
+	return fmt.Sprintf("%.6g", v)
+}
+
+func FormatDelta(v float64) string {
+	return fmt.Sprintf("%+.6g", v)
+}
+
+func FormatChange(v *float64) string {
+	if v == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.2f%%", *v)
+}
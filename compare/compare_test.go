@@ -0,0 +1,166 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/history/historytest"
+	"github.com/lightpanda-io/perf-fmt/runner"
+)
+
+func TestRecords(t *testing.T) {
+	for name, tc := range map[string]struct {
+		a, b   *historytest.Record
+		rows   []string
+		worse  []bool
+		hasEnv bool
+	}{
+		"deltas": {
+			a:     historytest.New("aaaaaaa", history.Metric{Name: "duration", Value: 100}, history.Metric{Name: "pass", Value: 10, HigherIsBetter: true}),
+			b:     historytest.New("bbbbbbb", history.Metric{Name: "duration", Value: 110}, history.Metric{Name: "pass", Value: 12, HigherIsBetter: true}),
+			rows:  []string{"duration 100 110 +10 +10.00%", "pass 10 12 +2 +20.00%"},
+			worse: []bool{true, false},
+		},
+		"missing metrics": {
+			a:     historytest.New("aaaaaaa", history.Metric{Name: "duration", Value: 100}, history.Metric{Name: "old", Value: 1}),
+			b:     historytest.New("bbbbbbb", history.Metric{Name: "new", Value: 1}, history.Metric{Name: "duration", Value: 90}),
+			rows:  []string{"duration 100 90 -10 -10.00%"},
+			worse: []bool{false},
+		},
+		"zero base": {
+			a:     historytest.New("aaaaaaa", history.Metric{Name: "crash", Value: 0}),
+			b:     historytest.New("bbbbbbb", history.Metric{Name: "crash", Value: 2}),
+			rows:  []string{"crash 0 2 +2 n/a"},
+			worse: []bool{true},
+		},
+		"env diff": {
+			a:      &historytest.Record{Entry: history.Entry{Hash: "aaaaaaa", Env: &runner.Env{Cores: 4}}},
+			b:      &historytest.Record{Entry: history.Entry{Hash: "bbbbbbb", Env: &runner.Env{Cores: 8}}},
+			hasEnv: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := Records(tc.a, tc.b)
+			if c.A != tc.a.Hash || c.B != tc.b.Hash {
+				t.Errorf("unexpected hashes %s %s", c.A, c.B)
+			}
+
+			var rows []string
+			for i, r := range c.Rows {
+				rows = append(rows, strings.Join([]string{r.Metric, FormatValue(r.A), FormatValue(r.B), FormatDelta(r.Delta), FormatChange(r.Change)}, " "))
+				if r.Worse() != tc.worse[i] {
+					t.Errorf("%s: expected worse %v", r.Metric, tc.worse[i])
+				}
+			}
+			if strings.Join(rows, "\n") != strings.Join(tc.rows, "\n") {
+				t.Errorf("got rows\n%s\nwant\n%s", strings.Join(rows, "\n"), strings.Join(tc.rows, "\n"))
+			}
+			if (len(c.EnvDiff) > 0) != tc.hasEnv {
+				t.Errorf("unexpected env diff %v", c.EnvDiff)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	records := []history.Record{
+		historytest.New("aaaaaaa1", history.Metric{Name: "duration", Value: 1}),
+		historytest.New("bbbbbbb1", history.Metric{Name: "duration", Value: 2}),
+	}
+
+	c, err := Compare(records, "aaaaaaa", "bbbbbbb")
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	if c.A != "aaaaaaa1" || len(c.Rows) != 1 {
+		t.Errorf("unexpected comparison %+v", c)
+	}
+
+	if _, err := Compare(records, "aaaaaaa", "ccccccc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	records = append(records, historytest.New("aaaaaaa2"))
+	if _, err := Compare(records, "aaaaaaa", "bbbbbbb"); !errors.Is(err, history.ErrAmbiguousHash) {
+		t.Errorf("expected ambiguous hash error, got %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	change := 10.0
+	c := Comparison{
+		A: "aaaaaaa",
+		B: "bbbbbbb",
+		Rows: []Row{
+			{Metric: "duration", A: 100, B: 110, Delta: 10, Change: &change},
+			{Metric: "crash", A: 0, B: 2, Delta: 2},
+		},
+		EnvDiff: []string{"cores: 4 != 8"},
+	}
+
+	for _, tc := range []struct {
+		format Format
+		want   string
+	}{
+		{
+			format: FormatText,
+			want: "metric    aaaaaaa  bbbbbbb  delta  change\n" +
+				"duration  100      110      +10    +10.00%\n" +
+				"crash     0        2        +2     n/a\n" +
+				"warning: environment differs: cores: 4 != 8\n",
+		},
+		{
+			format: FormatMarkdown,
+			want: "| metric | aaaaaaa | bbbbbbb | delta | change |\n" +
+				"|---|---:|---:|---:|---:|\n" +
+				"| duration | 100 | 110 | +10 | +10.00% |\n" +
+				"| crash | 0 | 2 | +2 | n/a |\n" +
+				"\n> [!WARNING]\n> The runner environments differ:\n> - cores: 4 != 8\n",
+		},
+	} {
+		var buf bytes.Buffer
+		if err := c.Write(&buf, tc.format); err != nil {
+			t.Fatalf("write %s: %v", tc.format, err)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.format, buf.String(), tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := c.Write(&buf, FormatJSON); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+	var got Comparison
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+	if len(got.Rows) != 2 || got.Rows[0].Change == nil || *got.Rows[0].Change != 10 || got.Rows[1].Change != nil {
+		t.Errorf("unexpected json %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"metrics"`) || strings.Count(buf.String(), `"change"`) != 1 {
+		t.Errorf("unexpected json %s", buf.String())
+	}
+
+	if err := c.Write(&buf, "xml"); !errors.Is(err, ErrBadFormat) {
+		t.Errorf("expected bad format error, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config reads the perf-fmt configuration file.
+// The file is optional, the env vars and the flags override its values.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lightpanda-io/perf-fmt/custom"
+)
+
+// DefaultFile is the configuration file read from the working directory
+// when no file is given.
+const DefaultFile = "perf-fmt.json"
+
+// Source configures a source.
+type Source struct {
+	// Path is the storage path of the source's history.
+	Path string `json:"path,omitempty"`
+	// Thresholds are the regression thresholds in percent by metric name.
+	Thresholds map[string]float64 `json:"thresholds,omitempty"`
+	// Metrics declares a custom source, the metrics are read from the
+	// input JSON. Builtin sources can't declare metrics.
+	Metrics []custom.Field `json:"metrics,omitempty"`
+}
+
+// CDN configures the cache invalidated after an append.
+type CDN struct {
+	CloudFrontDistribution string `json:"cloudfront_distribution,omitempty"`
+}
+
+type Config struct {
+	// Store is the storage url: s3://bucket/prefix, file:///dir or mem://
+	Store  string `json:"store,omitempty"`
+	Region string `json:"region,omitempty"`
+	// Prefix is prepended to the sources' paths, e.g. staging.
+	Prefix     string `json:"prefix,omitempty"`
+	MainBranch string `json:"main_branch,omitempty"`
+
+	// Baseline and Threshold are the regression check defaults.
+	Baseline  int     `json:"baseline,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+
+	// Sources configures the sources by name.
+	Sources map[string]Source `json:"sources,omitempty"`
+
+	CDN CDN `json:"cdn,omitzero"`
+}
+
+// Decode decodes a JSON configuration. Unknown fields are rejected to catch
+// typos.
+func Decode(r io.Reader) (Config, error) {
+	var c Config
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("decode config: %w", err)
+	}
+
+	return c, nil
+}
+
+// Load reads the configuration file.
+// If path is empty, the DefaultFile is read if it exists.
+func Load(path string) (Config, error) {
+	optional := path == ""
+	if optional {
+		path = DefaultFile
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if optional && errors.Is(err, os.ErrNotExist) {
+			return Config{}, nil
+		}
+		return Config{}, fmt.Errorf("read config: %w", err)
+	}
+
+	c, err := Decode(bytes.NewReader(b))
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Source returns the source's configuration.
+func (c Config) Source(name string) Source {
+	return c.Sources[name]
+}
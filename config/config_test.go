@@ -0,0 +1,72 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	c, err := Decode(strings.NewReader(`{
+		"store": "s3://lpd-perf-staging",
+		"prefix": "staging",
+		"threshold": 5,
+		"sources": {"cdp": {"path": "browser/cdp", "thresholds": {"duration_avg": 2}}},
+		"cdn": {"cloudfront_distribution": "E123"}
+	}`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if c.Store != "s3://lpd-perf-staging" || c.Prefix != "staging" || c.Threshold != 5 {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if s := c.Source("cdp"); s.Path != "browser/cdp" || s.Thresholds["duration_avg"] != 2 {
+		t.Errorf("unexpected source %+v", s)
+	}
+	if c.CDN.CloudFrontDistribution != "E123" {
+		t.Errorf("unexpected cdn %+v", c.CDN)
+	}
+
+	if _, err := Decode(strings.NewReader(`{"stroe": "mem://"}`)); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	// the default file is optional.
+	t.Chdir(t.TempDir())
+	if _, err := Load(""); err != nil {
+		t.Fatalf("load missing default file: %v", err)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	if err := os.WriteFile(DefaultFile, []byte(`{"store":"mem://"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load("")
+	if err != nil {
+		t.Fatalf("load default file: %v", err)
+	}
+	if c.Store != "mem://" {
+		t.Errorf("unexpected store %q", c.Store)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package custom implements the sources declared in the configuration.
+// The metrics are extracted from the input JSON with JMESPath expressions.
+package custom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/jmespath/go-jmespath"
+	"github.com/lightpanda-io/perf-fmt/history"
+)
+
+var (
+	ErrNoField    = errors.New("no field")
+	ErrBadField   = errors.New("bad field")
+	ErrNotANumber = errors.New("not a number")
+)
+
+// Field maps an input value to an output metric.
+type Field struct {
+	// Name is the output field name.
+	Name string `json:"name"`
+	// Expr is the JMESPath expression of the value in the input JSON,
+	// e.g. results[0].mean
+	Expr           string `json:"expr"`
+	Unit           string `json:"unit,omitempty"`
+	HigherIsBetter bool   `json:"higher_is_better,omitempty"`
+}
+
+type OutResult struct {
+	history.Entry
+	Values map[string]float64 `json:"values"`
+	Units  map[string]string  `json:"units,omitempty"`
+
+	// fields gives the metrics order and direction, it's set on convert and
+	// decode.
+	fields []Field
+}
+
+func (r *OutResult) Metrics() []history.Metric {
+	if r.fields == nil {
+		names := make([]string, 0, len(r.Values))
+		for name := range r.Values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		metrics := make([]history.Metric, 0, len(names))
+		for _, name := range names {
+			metrics = append(metrics, history.Metric{Name: name, Value: r.Values[name]})
+		}
+		return metrics
+	}
+
+	metrics := make([]history.Metric, 0, len(r.fields))
+	for _, f := range r.fields {
+		v, ok := r.Values[f.Name]
+		if !ok {
+			continue
+		}
+		metrics = append(metrics, history.Metric{Name: f.Name, Value: v, HigherIsBetter: f.HigherIsBetter})
+	}
+	return metrics
+}
+
+type Append struct {
+	// OnDuplicate is the policy applied when the commit already exists.
+	OnDuplicate history.Policy
+
+	fields []Field
+	exprs  []*jmespath.JMESPath
+}
+
+// NewAppend compiles the fields' expressions.
+func NewAppend(fields []Field, p history.Policy) (*Append, error) {
+	if len(fields) == 0 {
+		return nil, ErrNoField
+	}
+
+	a := &Append{OnDuplicate: p, fields: fields}
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		if f.Name == "" || seen[f.Name] {
+			return nil, fmt.Errorf("%w: empty or duplicated name %q", ErrBadField, f.Name)
+		}
+		seen[f.Name] = true
+
+		expr, err := jmespath.Compile(f.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrBadField, f.Name, err)
+		}
+		a.exprs = append(a.exprs, expr)
+	}
+
+	return a, nil
+}
+
+func (a *Append) Append(
+	ctx context.Context,
+	e history.Entry,
+	out io.Writer,
+	all io.Reader, one io.Reader,
+) error {
+	return history.Append(e, a.OnDuplicate, out, all, one, a.convert)
+}
+
+// Decode decodes the history.
+func (a *Append) Decode(r io.Reader) ([]history.Record, error) {
+	records, err := history.DecodeRecords[*OutResult](r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range records {
+		v.(*OutResult).fields = a.fields
+	}
+
+	return records, nil
+}
+
+func (a *Append) convert(inr any, e history.Entry) (*OutResult, error) {
+	res := &OutResult{
+		Entry:  e,
+		Values: make(map[string]float64, len(a.fields)),
+		fields: a.fields,
+	}
+
+	for i, f := range a.fields {
+		v, err := a.exprs[i].Search(inr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		n, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: %v", ErrNotANumber, f.Name, v)
+		}
+		res.Values[f.Name] = n
+
+		if f.Unit != "" {
+			if res.Units == nil {
+				res.Units = make(map[string]string)
+			}
+			res.Units[f.Name] = f.Unit
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package custom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lightpanda-io/perf-fmt/history"
+)
+
+func TestAppend(t *testing.T) {
+	a, err := NewAppend([]Field{
+		{Name: "mean", Expr: "results[0].mean", Unit: "s"},
+		{Name: "passed", Expr: "length(tests[?ok])", HigherIsBetter: true},
+	}, history.PolicyFail)
+	if err != nil {
+		t.Fatalf("new append: %v", err)
+	}
+
+	one := strings.NewReader(`{"results":[{"mean":0.5}],"tests":[{"ok":true},{"ok":false},{"ok":true}]}`)
+
+	var out bytes.Buffer
+	err = a.Append(context.Background(), history.Entry{Hash: "aaaaaaa"}, &out, strings.NewReader(""), one)
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	records, err := a.Decode(&out)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("unexpected records %d", len(records))
+	}
+
+	metrics := records[0].Metrics()
+	if len(metrics) != 2 ||
+		metrics[0] != (history.Metric{Name: "mean", Value: 0.5}) ||
+		metrics[1] != (history.Metric{Name: "passed", Value: 2, HigherIsBetter: true}) {
+		t.Errorf("unexpected metrics %+v", metrics)
+	}
+	if u := records[0].(*OutResult).Units["mean"]; u != "s" {
+		t.Errorf("unexpected unit %q", u)
+	}
+
+	// a missing value is not a number.
+	err = a.Append(context.Background(), history.Entry{Hash: "aaaaaaa"}, &out, strings.NewReader(""), strings.NewReader(`{}`))
+	if !errors.Is(err, ErrNotANumber) {
+		t.Errorf("expected not a number error, got %v", err)
+	}
+}
+
+func TestNewAppend(t *testing.T) {
+	if _, err := NewAppend(nil, history.PolicyFail); !errors.Is(err, ErrNoField) {
+		t.Errorf("expected no field error, got %v", err)
+	}
+	if _, err := NewAppend([]Field{{Name: "a", Expr: "results[0"}}, history.PolicyFail); !errors.Is(err, ErrBadField) {
+		t.Errorf("expected bad field error, got %v", err)
+	}
+	if _, err := NewAppend([]Field{{Name: "a", Expr: "a"}, {Name: "a", Expr: "b"}}, history.PolicyFail); !errors.Is(err, ErrBadField) {
+		t.Errorf("expected bad field error, got %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/audit"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/s3"
+	"github.com/lightpanda-io/perf-fmt/store"
+)
+
+// runDelete removes a commit's record from the source's history.
+func runDelete(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdDelete, flag.ExitOnError)
+
+	var (
+		reason = flags.String("reason", "", "reason of the deletion recorded in the audit log")
+		actor  = flags.String("actor", defaultActor(opts.getenv), "author of the deletion recorded in the audit log")
+	)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s <source> <commit> [delete options]\n", exec, CmdDelete)
+		fmt.Fprintf(stderr, "\nRemove the commit's record from the source's history, or the --branch one.\n")
+		fmt.Fprintf(stderr, "The deleted record is kept in the audit.jsonl log next to the history\n")
+		fmt.Fprintf(stderr, "and the commit's single results are skipped by the rebuild command.\n")
+		fmt.Fprintf(stderr, "\nThe delete options are:\n")
+		flags.PrintDefaults()
+	}
+	args, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	return editHistory(ctx, opts, args, audit.ActionDelete, *reason, *actor, stdout,
+		func(records []history.Record, ev *audit.Event) ([]history.Record, error) {
+			res, rec, err := history.Remove(records, ev.Commit)
+			if err != nil {
+				return nil, err
+			}
+
+			// the deleted record is kept in the log to be restorable.
+			if ev.Record, err = json.Marshal(rec); err != nil {
+				return nil, fmt.Errorf("json encode: %w", err)
+			}
+			ev.Commit = rec.Meta().Hash
+
+			return res, nil
+		})
+}
+
+// runQuarantine flags a commit's record of the source's history.
+// A quarantined record is kept but excluded from the baselines and the
+// change points analysis.
+func runQuarantine(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdQuarantine, flag.ExitOnError)
+
+	var (
+		reason  = flags.String("reason", "", "reason of the quarantine, required")
+		release = flags.Bool("release", false, "release the record from quarantine")
+		actor   = flags.String("actor", defaultActor(opts.getenv), "author of the change recorded in the audit log")
+	)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s <source> <commit> [quarantine options]\n", exec, CmdQuarantine)
+		fmt.Fprintf(stderr, "\nQuarantine the commit's record of the source's history, or the --branch one.\n")
+		fmt.Fprintf(stderr, "A quarantined record is kept but excluded from the baselines and the analysis.\n")
+		fmt.Fprintf(stderr, "The change is recorded in the audit.jsonl log next to the history.\n")
+		fmt.Fprintf(stderr, "\nThe quarantine options are:\n")
+		flags.PrintDefaults()
+	}
+	args, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+	if *reason == "" && !*release {
+		flags.Usage()
+		return errors.New("a reason is required")
+	}
+
+	action := audit.ActionQuarantine
+	if *release {
+		action = audit.ActionRelease
+	}
+
+	return editHistory(ctx, opts, args, action, *reason, *actor, stdout,
+		func(records []history.Record, ev *audit.Event) ([]history.Record, error) {
+			var q *history.Quarantine
+			if !*release {
+				q = &history.Quarantine{Reason: ev.Reason, Time: ev.Time}
+			}
+
+			rec, err := history.SetQuarantine(records, ev.Commit, q)
+			if err != nil {
+				return nil, err
+			}
+			ev.Commit = rec.Meta().Hash
+
+			return records, nil
+		})
+}
+
+// editFunc changes the records and completes the audit event.
+type editFunc func(records []history.Record, ev *audit.Event) ([]history.Record, error)
+
+// editHistory appends the change to the audit log, then applies the edit to
+// the history of the <source> <commit> args.
+func editHistory(ctx context.Context,
+	opts options, args []string,
+	action audit.Action, reason, actor string,
+	stdout io.Writer,
+	edit editFunc,
+) error {
+	src, path, err := opts.lookupSource(args[0], history.PolicyFail)
+	if err != nil {
+		return err
+	}
+
+	hash, err := opts.commit(ctx, args[1])
+	if err != nil {
+		return err
+	}
+
+	path = opts.branchPath(path, opts.branch)
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+
+	// apply decodes the history, edits it and encodes it back.
+	apply := func(cur []byte, ev *audit.Event) ([]byte, error) {
+		records, err := src.Decode(bytes.NewReader(cur))
+		if err != nil {
+			return nil, fmt.Errorf("decode history: %w", err)
+		}
+
+		if records, err = edit(records, ev); err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := history.Encode(&buf, records); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	ev := audit.Event{
+		Time:   time.Now().UTC(),
+		Action: action,
+		Source: args[0],
+		Commit: hash,
+		Reason: reason,
+		Actor:  actor,
+	}
+
+	// the edit is checked and the event completed on the current history,
+	// then the event is logged before the history is changed, so a change is
+	// never missing from the audit log.
+	item := st.Item(path+"/history.json", "application/json")
+	r, err := item.Pull(ctx)
+	if err != nil {
+		return fmt.Errorf("pull history: %w", err)
+	}
+	cur, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("read history: %w", err)
+	}
+	if _, err := apply(cur, &ev); err != nil {
+		return err
+	}
+
+	err = updateItem(ctx, st.Item(path+"/"+auditLog, "application/x-ndjson"), func(cur []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := audit.Append(&buf, bytes.NewReader(cur), ev); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+
+	err = updateItem(ctx, item, func(cur []byte) ([]byte, error) {
+		ev := ev
+		return apply(cur, &ev)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s %s in %s/history.json\n", action, ev.Commit, path)
+
+	return invalidate(ctx, st, opts, path)
+}
+
+// auditLog is the audit log file name stored next to the history.
+const auditLog = "audit.jsonl"
+
+// updateItem pulls the item, updates its content with fn and pushes it
+// back with a versioned push.
+// The whole cycle is retried if the item was modified in the meantime.
+func updateItem(ctx context.Context, item store.Item, fn func(cur []byte) ([]byte, error)) error {
+	for attempt := 1; ; attempt++ {
+		err := updateItemOnce(ctx, item, fn)
+		if !errors.Is(err, s3.ErrConflict) || attempt >= maxAppendAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * appendRetryDelay):
+		}
+	}
+}
+
+func updateItemOnce(ctx context.Context, item store.Item, fn func(cur []byte) ([]byte, error)) error {
+	r, version, err := item.PullVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("pull: %w", err)
+	}
+	cur, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+
+	b, err := fn(cur)
+	if err != nil {
+		return err
+	}
+
+	if err := item.PushVersion(ctx, bytes.NewReader(b), version); err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+
+	return nil
+}
+
+// parseInterspersed parses the flags placed before and after the
+// positional args and returns the positional args.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			return pos, nil
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+// defaultActor returns the GitHub Actions actor, or the current user.
+func defaultActor(getenv func(string) string) string {
+	if v := getenv("GITHUB_ACTOR"); v != "" {
+		return v
+	}
+	return getenv("USER")
+}
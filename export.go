@@ -0,0 +1,83 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/lightpanda-io/perf-fmt/history"
+)
+
+// runExport writes the source's history to stdout.
+func runExport(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdExport, flag.ExitOnError)
+
+	var (
+		format      = flags.String("format", "json", "output format: json or csv")
+		quarantined = flags.Bool("include-quarantined", false, "also write the quarantined records")
+	)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [export options] <source>\n", exec, CmdExport)
+		fmt.Fprintf(stderr, "\nWrite the source's history, or the --branch one, to stdout.\n")
+		fmt.Fprintf(stderr, "The csv format contains one column per metric.\n")
+		fmt.Fprintf(stderr, "The quarantined records are excluded by default.\n")
+		fmt.Fprintf(stderr, "\nThe export options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	if *format != "json" && *format != "csv" {
+		flags.Usage()
+		return fmt.Errorf("bad format: %q", *format)
+	}
+
+	src, path, err := opts.lookupSource(args[0], history.PolicyFail)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+
+	records, err := pullRecords(ctx, st, opts.branchPath(path, opts.branch), src)
+	if err != nil {
+		return err
+	}
+	if !*quarantined {
+		records = history.Active(records)
+	}
+
+	if *format == "csv" {
+		return history.WriteCSV(stdout, records)
+	}
+
+	return history.Encode(stdout, records)
+}
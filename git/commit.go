@@ -14,4 +14,73 @@
 
 package git
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrBadHash = errors.New("bad commit hash")
+
+const (
+	// MinHashLen is the minimum length of an abbreviated hash, shorter
+	// prefixes are likely to match several commits.
+	MinHashLen = 7
+	// ShortHashLen is the length of hashes shortened with Short.
+	ShortHashLen = 7
+	// FullHashLen is the length of a full SHA-1 hash.
+	FullHashLen = 40
+	// FullSHA256HashLen is the length of a full SHA-256 hash.
+	FullSHA256HashLen = 64
+)
+
 type CommitHash string
+
+// ParseCommitHash validates a full or abbreviated hexadecimal commit hash.
+// The returned hash is lower case.
+func ParseCommitHash(s string) (CommitHash, error) {
+	if len(s) < MinHashLen || len(s) > FullSHA256HashLen {
+		return "", fmt.Errorf("%w: %q: length must be between %d and %d", ErrBadHash, s, MinHashLen, FullSHA256HashLen)
+	}
+
+	s = strings.ToLower(s)
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", fmt.Errorf("%w: %q: not hexadecimal", ErrBadHash, s)
+		}
+	}
+
+	return CommitHash(s), nil
+}
+
+// IsFull returns true if the hash is not abbreviated.
+func (h CommitHash) IsFull() bool {
+	return len(h) == FullHashLen || len(h) == FullSHA256HashLen
+}
+
+// Short returns the abbreviated hash.
+func (h CommitHash) Short() CommitHash {
+	if len(h) <= ShortHashLen {
+		return h
+	}
+	return h[:ShortHashLen]
+}
+
+// Matches returns true if the hashes are equal or if one is an abbreviation
+// of the other. Full hashes match only if they are equal.
+func (h CommitHash) Matches(o CommitHash) bool {
+	if h == o {
+		return true
+	}
+	if h.IsFull() && o.IsFull() {
+		return strings.EqualFold(string(h), string(o))
+	}
+	if len(h) < MinHashLen || len(o) < MinHashLen {
+		return false
+	}
+
+	if len(h) > len(o) {
+		h, o = o, h
+	}
+	return strings.HasPrefix(strings.ToLower(string(o)), strings.ToLower(string(h)))
+}
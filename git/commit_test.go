@@ -0,0 +1,65 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCommitHash(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		out CommitHash
+		err error
+	}{
+		{in: "0883be2", out: "0883be2"},
+		{in: "0883BE2", out: "0883be2"},
+		{in: "c22d5260f0e4a8b8b3a51e1c1a4f2b9e4f0d1a2b", out: "c22d5260f0e4a8b8b3a51e1c1a4f2b9e4f0d1a2b"},
+		{in: "", err: ErrBadHash},
+		{in: "abc", err: ErrBadHash},
+		{in: "0883be", err: ErrBadHash},
+		{in: "main", err: ErrBadHash},
+		{in: "0883be2; rm -rf", err: ErrBadHash},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			h, err := ParseCommitHash(tc.in)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if h != tc.out {
+				t.Errorf("expected %q, got %q", tc.out, h)
+			}
+		})
+	}
+}
+
+func TestCommitHashMatches(t *testing.T) {
+	full := CommitHash("c22d5260f0e4a8b8b3a51e1c1a4f2b9e4f0d1a2b")
+
+	if !full.Matches("c22d526") || !CommitHash("c22d526").Matches(full) {
+		t.Error("expected abbreviated hash to match")
+	}
+	if full.Matches("c22d527") {
+		t.Error("unexpected match")
+	}
+	if full.Matches("c22d52") {
+		t.Error("unexpected match of a too short hash")
+	}
+	// a SHA-256 hash starting like the SHA-1 one is another commit.
+	if full.Matches(full + "0123456789abcdef01234567") {
+		t.Error("unexpected match of full hashes")
+	}
+}
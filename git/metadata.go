@@ -0,0 +1,124 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Metadata describes a commit for humans.
+// All the fields are optional.
+type Metadata struct {
+	Branch  string `json:"branch,omitempty"`
+	PR      int    `json:"pr,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	Author  string `json:"author,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+// Merge returns m with its empty fields set from o.
+func (m Metadata) Merge(o Metadata) Metadata {
+	if m.Branch == "" {
+		m.Branch = o.Branch
+	}
+	if m.PR == 0 {
+		m.PR = o.PR
+	}
+	if m.Subject == "" {
+		m.Subject = o.Subject
+	}
+	if m.Author == "" {
+		m.Author = o.Author
+	}
+	if m.Tag == "" {
+		m.Tag = o.Tag
+	}
+	return m
+}
+
+// MetadataFromEnv reads the metadata from the GitHub Actions env vars.
+// The env vars are ignored if GITHUB_SHA is set to another commit than hash.
+func MetadataFromEnv(getenv func(string) string, hash CommitHash) Metadata {
+	if sha := getenv("GITHUB_SHA"); sha != "" && !hash.Matches(CommitHash(sha)) {
+		return Metadata{}
+	}
+
+	m := Metadata{Branch: BranchFromEnv(getenv)}
+
+	ref := getenv("GITHUB_REF")
+	switch {
+	case strings.HasPrefix(ref, "refs/tags/"):
+		m.Tag = strings.TrimPrefix(ref, "refs/tags/")
+	case strings.HasPrefix(ref, "refs/pull/"):
+		// refs/pull/<number>/merge
+		n, _, _ := strings.Cut(strings.TrimPrefix(ref, "refs/pull/"), "/")
+		m.PR, _ = strconv.Atoi(n)
+	}
+
+	return m
+}
+
+// BranchFromEnv reads the branch from the GitHub Actions env vars: the PR's
+// source branch GITHUB_HEAD_REF, then the pushed branch GITHUB_REF.
+func BranchFromEnv(getenv func(string) string) string {
+	if head := getenv("GITHUB_HEAD_REF"); head != "" {
+		return head
+	}
+
+	ref, ok := strings.CutPrefix(getenv("GITHUB_REF"), "refs/heads/")
+	if !ok {
+		return ""
+	}
+	return ref
+}
+
+// Branch returns the repository's current branch, it's empty for a
+// detached HEAD.
+func (r Repo) Branch(ctx context.Context) (string, error) {
+	out, err := r.git(ctx, "branch", "--show-current")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// Metadata reads the commit's subject, author and tag. The branch is set if
+// the commit is the repository's HEAD.
+func (r Repo) Metadata(ctx context.Context, hash CommitHash) (Metadata, error) {
+	out, err := r.git(ctx, "show", "--no-patch", "--format=%an%n%s", string(hash))
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	var m Metadata
+	m.Author, m.Subject, _ = strings.Cut(strings.TrimRight(out, "\n"), "\n")
+
+	out, err = r.git(ctx, "tag", "--points-at", string(hash))
+	if err != nil {
+		return Metadata{}, err
+	}
+	m.Tag, _, _ = strings.Cut(strings.TrimSpace(out), "\n")
+
+	if head, err := r.Resolve(ctx, "HEAD"); err == nil && head.Matches(hash) {
+		if m.Branch, err = r.Branch(ctx); err != nil {
+			return Metadata{}, err
+		}
+	}
+
+	return m, nil
+}
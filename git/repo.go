@@ -0,0 +1,109 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var ErrUnknownRef = errors.New("unknown ref")
+
+// Repo is a local git repository.
+// It's read with the git command which must be installed.
+type Repo struct {
+	Dir string
+}
+
+// Resolve returns the full hash of the commit pointed by the ref.
+// The ref can be HEAD, a branch or tag name or an abbreviated hash.
+func (r Repo) Resolve(ctx context.Context, ref string) (CommitHash, error) {
+	out, err := r.git(ctx, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrUnknownRef, ref)
+	}
+
+	return ParseCommitHash(strings.TrimSpace(out))
+}
+
+// Commit contains the commit's topology and dates.
+type Commit struct {
+	Hash       CommitHash
+	Parents    []CommitHash
+	AuthorTime time.Time
+	CommitTime time.Time
+}
+
+// Commit reads the commit pointed by the ref.
+func (r Repo) Commit(ctx context.Context, ref string) (Commit, error) {
+	hash, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return Commit{}, err
+	}
+
+	out, err := r.git(ctx, "show", "--no-patch", "--format=%P%n%aI%n%cI", string(hash))
+	if err != nil {
+		return Commit{}, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		return Commit{}, fmt.Errorf("unexpected git show output: %q", out)
+	}
+
+	c := Commit{Hash: hash}
+
+	for _, p := range strings.Fields(lines[0]) {
+		parent, err := ParseCommitHash(p)
+		if err != nil {
+			return Commit{}, fmt.Errorf("parent: %w", err)
+		}
+		c.Parents = append(c.Parents, parent)
+	}
+
+	if c.AuthorTime, err = time.Parse(time.RFC3339, lines[1]); err != nil {
+		return Commit{}, fmt.Errorf("author date: %w", err)
+	}
+	if c.CommitTime, err = time.Parse(time.RFC3339, lines[2]); err != nil {
+		return Commit{}, fmt.Errorf("commit date: %w", err)
+	}
+	c.AuthorTime = c.AuthorTime.UTC()
+	c.CommitTime = c.CommitTime.UTC()
+
+	return c, nil
+}
+
+// git runs a git command in the repository and returns its stdout.
+func (r Repo) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", r.Dir}, args...)...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package git
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// testRepo creates a repository with two commits on the main branch, the
+// first one is tagged v1.
+func testRepo(t *testing.T) Repo {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not found")
+	}
+
+	r := Repo{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	for _, args := range [][]string{
+		{"init", "--quiet", "--initial-branch=main"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com",
+			"commit", "--quiet", "--allow-empty", "-m", "first commit"},
+		{"tag", "v1"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com",
+			"commit", "--quiet", "--allow-empty", "-m", "second commit"},
+	} {
+		if _, err := r.git(ctx, args...); err != nil {
+			t.Fatalf("setup repo: %v", err)
+		}
+	}
+
+	return r
+}
+
+func TestRepoResolve(t *testing.T) {
+	r := testRepo(t)
+	ctx := context.Background()
+
+	head, err := r.Resolve(ctx, "HEAD")
+	if err != nil {
+		t.Fatalf("resolve HEAD: %v", err)
+	}
+	if !head.IsFull() {
+		t.Fatalf("expected full hash, got %q", head)
+	}
+
+	for _, ref := range []string{"main", string(head.Short())} {
+		h, err := r.Resolve(ctx, ref)
+		if err != nil {
+			t.Fatalf("resolve %s: %v", ref, err)
+		}
+		if h != head {
+			t.Errorf("resolve %s: expected %q, got %q", ref, head, h)
+		}
+	}
+
+	if _, err := r.Resolve(ctx, "unknown"); !errors.Is(err, ErrUnknownRef) {
+		t.Errorf("expected unknown ref error, got %v", err)
+	}
+}
+
+func TestRepoCommit(t *testing.T) {
+	r := testRepo(t)
+	ctx := context.Background()
+
+	c, err := r.Commit(ctx, "HEAD")
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	v1, err := r.Resolve(ctx, "v1")
+	if err != nil {
+		t.Fatalf("resolve v1: %v", err)
+	}
+
+	if len(c.Parents) != 1 || c.Parents[0] != v1 {
+		t.Errorf("unexpected parents %v", c.Parents)
+	}
+	if c.CommitTime.IsZero() || c.AuthorTime.IsZero() {
+		t.Errorf("unexpected dates %+v", c)
+	}
+}
+
+func TestRepoMetadata(t *testing.T) {
+	r := testRepo(t)
+	ctx := context.Background()
+
+	v1, err := r.Resolve(ctx, "v1")
+	if err != nil {
+		t.Fatalf("resolve v1: %v", err)
+	}
+
+	m, err := r.Metadata(ctx, v1)
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	if m != (Metadata{Subject: "first commit", Author: "Test", Tag: "v1"}) {
+		t.Errorf("unexpected v1 metadata %+v", m)
+	}
+
+	head, err := r.Resolve(ctx, "HEAD")
+	if err != nil {
+		t.Fatalf("resolve HEAD: %v", err)
+	}
+
+	m, err = r.Metadata(ctx, head)
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	if m != (Metadata{Branch: "main", Subject: "second commit", Author: "Test"}) {
+		t.Errorf("unexpected HEAD metadata %+v", m)
+	}
+}
+
+func TestMetadataFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		env map[string]string
+		m   Metadata
+	}{
+		{env: map[string]string{"GITHUB_SHA": "abcdef0123", "GITHUB_REF": "refs/heads/main"}, m: Metadata{Branch: "main"}},
+		{env: map[string]string{"GITHUB_REF": "refs/tags/v1.0"}, m: Metadata{Tag: "v1.0"}},
+		{env: map[string]string{"GITHUB_REF": "refs/pull/42/merge", "GITHUB_HEAD_REF": "feature"}, m: Metadata{PR: 42, Branch: "feature"}},
+		// another commit than the ingested one.
+		{env: map[string]string{"GITHUB_SHA": "0123456789", "GITHUB_REF": "refs/heads/main"}},
+	} {
+		m := MetadataFromEnv(func(k string) string { return tc.env[k] }, "abcdef0")
+		if m != tc.m {
+			t.Errorf("env %v: expected %+v, got %+v", tc.env, tc.m, m)
+		}
+	}
+}
@@ -2,6 +2,7 @@ module github.com/lightpanda-io/perf-fmt
 
 go 1.24
 
-require github.com/aws/aws-sdk-go v1.55.7
-
-require github.com/jmespath/go-jmespath v0.4.0 // indirect
+require (
+	github.com/aws/aws-sdk-go v1.55.7
+	github.com/jmespath/go-jmespath v0.4.0
+)
@@ -0,0 +1,74 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// WriteCSV writes the records in CSV, one line per record and one column
+// per metric. A metric missing from a record is an empty cell.
+func WriteCSV(w io.Writer, records []Record) error {
+	// metrics columns are in order of appearance.
+	var names []string
+	columns := make(map[string]int)
+	values := make([]map[string]float64, len(records))
+	for i, r := range records {
+		values[i] = make(map[string]float64)
+		for _, m := range Values(r) {
+			if _, ok := columns[m.Name]; !ok {
+				columns[m.Name] = len(names)
+				names = append(names, m.Name)
+			}
+			values[i][m.Name] = m.Value
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"commit", "datetime", "commit_datetime", "branch"}, names...)); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+
+	for i, r := range records {
+		e := r.Meta()
+		line := []string{string(e.Hash), e.Time.Format(time.RFC3339), "", e.Branch}
+		if !e.CommitTime.IsZero() {
+			line[2] = e.CommitTime.Format(time.RFC3339)
+		}
+		for _, name := range names {
+			v, ok := values[i][name]
+			if !ok {
+				line = append(line, "")
+				continue
+			}
+			line = append(line, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+
+		if err := cw.Write(line); err != nil {
+			return fmt.Errorf("write csv: %w", err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+)
+
+type ChangeKind string
+
+const (
+	Added    ChangeKind = "added"
+	Replaced ChangeKind = "replaced"
+	Removed  ChangeKind = "removed"
+)
+
+// Change is a record difference between two histories.
+type Change struct {
+	Kind ChangeKind
+	Hash git.CommitHash
+	// Old is nil for an added record, New is nil for a removed one.
+	Old, New Record
+}
+
+// Diff returns the records added, replaced or removed from old to new.
+// The records are identified by their commit hash and compared by their
+// JSON encoding.
+func Diff(old, new []Record) ([]Change, error) {
+	olds := make(map[git.CommitHash]Record, len(old))
+	for _, v := range old {
+		olds[v.Meta().Hash] = v
+	}
+
+	var changes []Change
+	news := make(map[git.CommitHash]bool, len(new))
+	for _, v := range new {
+		hash := v.Meta().Hash
+		news[hash] = true
+
+		o, ok := olds[hash]
+		if !ok {
+			changes = append(changes, Change{Kind: Added, Hash: hash, New: v})
+			continue
+		}
+
+		bo, err := json.Marshal(o)
+		if err != nil {
+			return nil, fmt.Errorf("encode record: %w", err)
+		}
+		bn, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode record: %w", err)
+		}
+		if !bytes.Equal(bo, bn) {
+			changes = append(changes, Change{Kind: Replaced, Hash: hash, Old: o, New: v})
+		}
+	}
+
+	for _, v := range old {
+		if hash := v.Meta().Hash; !news[hash] {
+			changes = append(changes, Change{Kind: Removed, Hash: hash, Old: v})
+		}
+	}
+
+	return changes, nil
+}
+
+// WriteDiff writes the changes as a readable diff of the records.
+func WriteDiff(w io.Writer, changes []Change) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(w, "no change")
+		return err
+	}
+
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s %s\n", c.Kind, c.Hash)
+		if c.Old != nil {
+			b, err := json.Marshal(c.Old)
+			if err != nil {
+				return fmt.Errorf("encode record: %w", err)
+			}
+			fmt.Fprintf(w, "- %s\n", b)
+		}
+		if c.New != nil {
+			b, err := json.Marshal(c.New)
+			if err != nil {
+				return fmt.Errorf("encode record: %w", err)
+			}
+			fmt.Fprintf(w, "+ %s\n", b)
+		}
+	}
+
+	return nil
+}
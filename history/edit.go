@@ -0,0 +1,73 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+)
+
+var ErrNotFound = errors.New("commit not found")
+
+// Quarantine describes why a record is quarantined.
+type Quarantine struct {
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"datetime"`
+}
+
+// Quarantined returns true if the record is quarantined.
+func Quarantined(rec Record) bool {
+	return rec.Meta().Quarantine != nil
+}
+
+// Active returns the records not quarantined.
+func Active(records []Record) []Record {
+	var res []Record
+	for _, v := range records {
+		if !Quarantined(v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// Remove removes the hash's record from the records.
+// It returns the new records and the removed one.
+func Remove(records []Record, hash git.CommitHash) ([]Record, Record, error) {
+	i, err := Index(records, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rec := records[i]
+	res := append(records[:i:i], records[i+1:]...)
+
+	return res, rec, nil
+}
+
+// SetQuarantine quarantines the hash's record, or releases it if q is nil.
+// It returns the updated record.
+func SetQuarantine(records []Record, hash git.CommitHash, q *Quarantine) (Record, error) {
+	i, err := Index(records, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	records[i].Meta().Quarantine = q
+
+	return records[i], nil
+}
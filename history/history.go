@@ -0,0 +1,271 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package history manages the history.json files shared by all the sources.
+// A history is a versioned envelope {"version":N,"entries":[...]} of records
+// ordered by commit, with one record per commit. A record can merge several
+// runs of the same commit. The legacy histories are bare JSON arrays.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/runner"
+	"github.com/lightpanda-io/perf-fmt/stats"
+)
+
+var (
+	ErrHashExists = errors.New("hash exists")
+	ErrNoHash     = errors.New("missing commit hash")
+	ErrBadPolicy  = errors.New("bad duplicate policy")
+	ErrNullRecord = errors.New("null record")
+	// ErrAmbiguousHash is returned for an abbreviated hash matching several
+	// records.
+	ErrAmbiguousHash = errors.New("ambiguous commit hash")
+)
+
+// Policy defines how Append handles a commit already existing in the history.
+type Policy string
+
+const (
+	// PolicyFail returns ErrHashExists. It's the default policy.
+	PolicyFail Policy = "fail"
+	// PolicyReplace replaces the existing records by the new one.
+	PolicyReplace Policy = "replace"
+	// PolicyKeep keeps the existing records and ignores the new one.
+	PolicyKeep Policy = "keep"
+	// PolicyAppendRun keeps the existing records and adds the new one as an
+	// additional run of the commit.
+	PolicyAppendRun Policy = "append-run"
+)
+
+var Policies = []Policy{PolicyFail, PolicyReplace, PolicyKeep, PolicyAppendRun}
+
+func ParsePolicy(s string) (Policy, error) {
+	for _, p := range Policies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrBadPolicy, s)
+}
+
+// Entry contains the fields common to all history records.
+// Sources embed it in their output result.
+type Entry struct {
+	Hash git.CommitHash `json:"commit"`
+	// Time is the ingestion time of the result.
+	Time time.Time `json:"datetime"`
+
+	// The commit's topology and dates are optional, older records don't
+	// have them.
+	Parents    []git.CommitHash `json:"parents,omitempty"`
+	AuthorTime time.Time        `json:"author_datetime,omitzero"`
+	CommitTime time.Time        `json:"commit_datetime,omitzero"`
+
+	// Metadata describes the commit: branch, PR, subject...
+	git.Metadata
+
+	// Env is the fingerprint of the machine running the benchmark.
+	Env *runner.Env `json:"env,omitempty"`
+
+	// Quarantine flags a record kept in the history but excluded from the
+	// baselines and the charts.
+	Quarantine *Quarantine `json:"quarantine,omitempty"`
+
+	// Runs is the number of runs merged into the record, it's omitted for
+	// a single run.
+	Runs int `json:"runs,omitempty"`
+	// Samples contains the metric values of every run by metric name.
+	Samples map[string][]float64 `json:"samples,omitempty"`
+	// Stats are computed from the samples when the history is encoded.
+	Stats map[string]stats.Summary `json:"stats,omitempty"`
+}
+
+// Meta returns the entry. The method is promoted to the sources' output
+// results embedding an Entry.
+func (e *Entry) Meta() *Entry {
+	return e
+}
+
+// Record is a history record, usually a pointer to a source's output result.
+type Record interface {
+	Meta() *Entry
+	// Metrics returns the record's metric values.
+	Metrics() []Metric
+}
+
+// ConvertFunc converts a source's input result into a history record using
+// the entry e.
+type ConvertFunc[In any, Out Record] func(in In, e Entry) (Out, error)
+
+// Append decodes the one input, converts it into a record and appends it to
+// the all history. The resulting history is encoded into out.
+// The policy p is applied if the commit already exists in the history.
+func Append[In any, Out Record](
+	e Entry, p Policy,
+	out io.Writer,
+	all io.Reader, one io.Reader,
+	convert ConvertFunc[In, Out],
+) error {
+	if e.Hash == "" {
+		return ErrNoHash
+	}
+
+	// decode one input
+	var inr In
+	if err := json.NewDecoder(one).Decode(&inr); err != nil {
+		return fmt.Errorf("decode one: %w", err)
+	}
+
+	// decode all input
+	allres, err := Decode[Out](all)
+	if err != nil {
+		return err
+	}
+
+	outres, err := convert(inr, e)
+	if err != nil {
+		return fmt.Errorf("convert: %w", err)
+	}
+
+	allres, err = Merge(allres, outres, p)
+	if err != nil {
+		return err
+	}
+
+	return Encode(out, allres)
+}
+
+// Merge adds the record to the history, applying the policy p if the
+// record's commit already exists.
+func Merge[Out Record](allres []Out, rec Out, p Policy) ([]Out, error) {
+	hash := rec.Meta().Hash
+
+	// search if the commit already exists in the all results to avoid duplication.
+	i, err := Index(allres, hash)
+	if errors.Is(err, ErrNotFound) {
+		return append(allres, rec), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch p {
+	case PolicyFail, "":
+		return nil, ErrHashExists
+	case PolicyKeep:
+		return allres, nil
+	case PolicyAppendRun:
+		AddRun(allres[i], rec)
+		return allres, nil
+	case PolicyReplace:
+		return append(append(allres[:i:i], allres[i+1:]...), rec), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrBadPolicy, p)
+	}
+}
+
+// Index returns the index of the hash's record.
+// It returns ErrNotFound if the hash has no record and ErrAmbiguousHash if
+// an abbreviated hash matches several records.
+func Index[Out Record](allres []Out, hash git.CommitHash) (int, error) {
+	idx := -1
+	for i, v := range allres {
+		if !v.Meta().Hash.Matches(hash) {
+			continue
+		}
+		if idx >= 0 {
+			return -1, fmt.Errorf("%w: %s", ErrAmbiguousHash, hash)
+		}
+		idx = i
+	}
+	if idx < 0 {
+		return -1, fmt.Errorf("%w: %s", ErrNotFound, hash)
+	}
+
+	return idx, nil
+}
+
+// Decode decodes a legacy array or a versioned history.
+// An empty reader returns an empty history. A version other than the Out
+// records one returns ErrOutdated or ErrUnsupportedVersion.
+func Decode[Out Record](r io.Reader) ([]Out, error) {
+	version, entries, err := decodeRaw(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if err := checkVersion(version, schemaVersion[Out](nil), entries); err != nil {
+		return nil, err
+	}
+
+	var allres []Out
+	if err := json.Unmarshal(entries, &allres); err != nil {
+		return nil, fmt.Errorf("decode all: %w", err)
+	}
+
+	// a null record decodes to a nil pointer.
+	for i, v := range allres {
+		if rv := reflect.ValueOf(v); !rv.IsValid() || rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return nil, fmt.Errorf("%w: index %d", ErrNullRecord, i)
+		}
+	}
+
+	return allres, nil
+}
+
+// DecodeRecords decodes a history of Out records as generic records.
+func DecodeRecords[Out Record](r io.Reader) ([]Record, error) {
+	allres, err := Decode[Out](r)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, len(allres))
+	for i, v := range allres {
+		records[i] = v
+	}
+
+	return records, nil
+}
+
+// Encode sorts the records, computes the stats of the records with
+// several runs and encodes them in a versioned envelope.
+func Encode[Out Record](w io.Writer, allres []Out) error {
+	Sort(allres)
+
+	for _, v := range allres {
+		v.Meta().computeStats()
+	}
+
+	env := envelope[Out]{Version: schemaVersion(allres), Entries: allres}
+	if env.Entries == nil {
+		env.Entries = []Out{}
+	}
+	if err := json.NewEncoder(w).Encode(env); err != nil {
+		return fmt.Errorf("encode out: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,407 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+)
+
+type testIn struct {
+	Value int `json:"value"`
+}
+
+type testOut struct {
+	Entry
+	Value int `json:"value"`
+}
+
+func (r *testOut) Metrics() []Metric {
+	return []Metric{{Name: "value", Value: float64(r.Value)}}
+}
+
+func testConvert(in testIn, e Entry) (*testOut, error) {
+	return &testOut{Entry: e, Value: in.Value}, nil
+}
+
+func TestAppend(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	all := `[{"commit":"bbbbbbb","datetime":"2024-01-03T00:00:00Z","value":2}]`
+
+	var out bytes.Buffer
+	err := Append(Entry{Hash: "aaaaaaa", Time: t0}, PolicyFail, &out, strings.NewReader(all), strings.NewReader(`{"value":1}`), testConvert)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := Decode[*testOut](&out)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(res) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(res))
+	}
+	// records are sorted by time.
+	if res[0].Hash != "aaaaaaa" || res[0].Value != 1 || res[1].Hash != "bbbbbbb" {
+		t.Errorf("unexpected records: %+v %+v", res[0], res[1])
+	}
+
+	err = Append(Entry{Hash: "bbbbbbb", Time: t0}, PolicyFail, &out, strings.NewReader(all), strings.NewReader(`{"value":1}`), testConvert)
+	if !errors.Is(err, ErrHashExists) {
+		t.Errorf("expected hash exists error, got %v", err)
+	}
+}
+
+func TestAppendEmpty(t *testing.T) {
+	var out bytes.Buffer
+	err := Append(Entry{Hash: "aaaaaaa"}, PolicyFail, &out, strings.NewReader(""), strings.NewReader(`{"value":1}`), testConvert)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := strings.TrimSpace(out.String()); got != `{"version":1,"entries":[{"commit":"aaaaaaa","datetime":"0001-01-01T00:00:00Z","value":1}]}` {
+		t.Errorf("unexpected output: %s", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	history := func() []*testOut {
+		return []*testOut{
+			{Entry: Entry{Hash: "aaaaaaa", Time: t0}, Value: 1},
+			{Entry: Entry{Hash: "bbbbbbb", Time: t0.Add(time.Hour)}, Value: 2},
+		}
+	}
+	rec := &testOut{Entry: Entry{Hash: "aaaaaaa", Time: t0.Add(2 * time.Hour)}, Value: 3}
+
+	for _, tc := range []struct {
+		policy Policy
+		err    error
+		values []int
+	}{
+		{policy: PolicyFail, err: ErrHashExists},
+		{policy: PolicyKeep, values: []int{1, 2}},
+		{policy: PolicyReplace, values: []int{2, 3}},
+		{policy: PolicyAppendRun, values: []int{1, 2}},
+		{policy: "bad", err: ErrBadPolicy},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			res, err := Merge(history(), rec, tc.policy)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+
+			var values []int
+			for _, v := range res {
+				values = append(values, v.Value)
+			}
+			if len(values) != len(tc.values) {
+				t.Fatalf("expected values %v, got %v", tc.values, values)
+			}
+			for i := range values {
+				if values[i] != tc.values[i] {
+					t.Fatalf("expected values %v, got %v", tc.values, values)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeAmbiguous(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	history := []*testOut{
+		{Entry: Entry{Hash: "aaaaaaa1", Time: t0}, Value: 1},
+		{Entry: Entry{Hash: "aaaaaaa2", Time: t0}, Value: 2},
+	}
+
+	for _, p := range []Policy{PolicyReplace, PolicyAppendRun} {
+		_, err := Merge(history, &testOut{Entry: Entry{Hash: "aaaaaaa"}, Value: 3}, p)
+		if !errors.Is(err, ErrAmbiguousHash) {
+			t.Errorf("%s: expected ambiguous hash error, got %v", p, err)
+		}
+	}
+
+	// a full hash replaces only its record.
+	res, err := Merge(history, &testOut{Entry: Entry{Hash: "aaaaaaa1"}, Value: 3}, PolicyReplace)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if len(res) != 2 || res[0].Value != 2 || res[1].Value != 3 {
+		t.Errorf("unexpected records %+v %+v", res[0], res[1])
+	}
+}
+
+func TestAppendRun(t *testing.T) {
+	all := ""
+	for _, v := range []string{`{"value":1}`, `{"value":5}`, `{"value":3}`} {
+		var out bytes.Buffer
+		err := Append(Entry{Hash: "aaaaaaa"}, PolicyAppendRun, &out, strings.NewReader(all), strings.NewReader(v), testConvert)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		all = out.String()
+	}
+
+	res, err := Decode[*testOut](strings.NewReader(all))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(res) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(res))
+	}
+
+	rec := res[0]
+	if rec.Runs != 3 || rec.Value != 1 {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+
+	s := rec.Stats["value"]
+	if s.Min != 1 || s.Median != 3 || s.Mean != 3 || s.Max != 5 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+
+	if v := Values(rec)[0].Value; v != 3 {
+		t.Errorf("expected median value 3, got %v", v)
+	}
+}
+
+func TestSort(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	res := []*testOut{
+		// backfilled child with an author clock skew: its commit time is
+		// before its parent's one.
+		{Entry: Entry{Hash: "cccccccc", Time: t0.Add(5 * time.Hour), CommitTime: t0.Add(time.Hour), Parents: []git.CommitHash{"bbbbbbbbbb"}}},
+		{Entry: Entry{Hash: "bbbbbbbbbb", Time: t0.Add(4 * time.Hour), CommitTime: t0.Add(2 * time.Hour)}},
+		// legacy record without commit time.
+		{Entry: Entry{Hash: "aaaaaaa", Time: t0}},
+		{Entry: Entry{Hash: "ddddddd", Time: t0.Add(3 * time.Hour), CommitTime: t0.Add(3 * time.Hour)}},
+	}
+
+	Sort(res)
+
+	var hashes []git.CommitHash
+	for _, v := range res {
+		hashes = append(hashes, v.Hash)
+	}
+
+	expected := []git.CommitHash{"aaaaaaa", "bbbbbbbbbb", "cccccccc", "ddddddd"}
+	for i := range expected {
+		if hashes[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, hashes)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := []Record{
+		&testOut{Entry: Entry{Hash: "aaaaaaa"}, Value: 1},
+		&testOut{Entry: Entry{Hash: "bbbbbbb"}, Value: 2},
+		&testOut{Entry: Entry{Hash: "ccccccc"}, Value: 3},
+	}
+	new := []Record{
+		&testOut{Entry: Entry{Hash: "aaaaaaa"}, Value: 1},
+		&testOut{Entry: Entry{Hash: "bbbbbbb"}, Value: 4},
+		&testOut{Entry: Entry{Hash: "ddddddd"}, Value: 5},
+	}
+
+	changes, err := Diff(old, new)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+
+	expected := []struct {
+		kind ChangeKind
+		hash git.CommitHash
+	}{
+		{Replaced, "bbbbbbb"},
+		{Added, "ddddddd"},
+		{Removed, "ccccccc"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	for i, c := range changes {
+		if c.Kind != expected[i].kind || c.Hash != expected[i].hash {
+			t.Errorf("unexpected change %d: %s %s", i, c.Kind, c.Hash)
+		}
+	}
+}
+
+func TestResultName(t *testing.T) {
+	t0 := time.Date(2024, 1, 2, 15, 4, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		expected ResultName
+		err      error
+	}{
+		{name: "2024-01-02_15-04_aaaaaaa.json", expected: ResultName{Time: t0, Hash: "aaaaaaa", Run: 1}},
+		{name: "2024-01-02_15-04_aaaaaaa_3.json", expected: ResultName{Time: t0, Hash: "aaaaaaa", Run: 3}},
+		{name: "2024-01-02_15-04_aaaaaaa_bench.txt", expected: ResultName{Time: t0, Hash: "aaaaaaa", Run: 1}},
+		{name: "history.json", err: ErrBadName},
+		{name: "2024-01-02_15-04_zzz.json", err: ErrBadName},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := ParseResultName(tc.name)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if n != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, n)
+			}
+		})
+	}
+
+	if s := (ResultName{Time: t0, Hash: "aaaaaaa", Run: 2}).String(); s != "2024-01-02_15-04_aaaaaaa_2.json" {
+		t.Errorf("unexpected name %q", s)
+	}
+}
+
+func TestRemoveAndQuarantine(t *testing.T) {
+	records := []Record{
+		&testOut{Entry: Entry{Hash: "aaaaaaa"}, Value: 1},
+		&testOut{Entry: Entry{Hash: "bbbbbbb"}, Value: 2},
+		&testOut{Entry: Entry{Hash: "ccccccc"}, Value: 3},
+	}
+
+	rec, err := SetQuarantine(records, "bbbbbbb", &Quarantine{Reason: "noisy runner"})
+	if err != nil {
+		t.Fatalf("quarantine: %v", err)
+	}
+	if !Quarantined(rec) || len(Active(records)) != 2 {
+		t.Errorf("record not quarantined")
+	}
+
+	if _, err := SetQuarantine(records, "bbbbbbb", nil); err != nil || len(Active(records)) != 3 {
+		t.Errorf("record not released: %v", err)
+	}
+
+	res, rec, err := Remove(records, "aaaaaaa")
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if len(res) != 2 || rec.Meta().Hash != "aaaaaaa" || res[0].Meta().Hash != "bbbbbbb" {
+		t.Errorf("unexpected records after remove")
+	}
+	// the input records are not modified.
+	if records[0].Meta().Hash != "aaaaaaa" {
+		t.Errorf("input records modified")
+	}
+
+	if _, _, err := Remove(records, "ddddddd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	// a short hash matching several records is refused.
+	records = append(records, &testOut{Entry: Entry{Hash: "aaaaaaa1"}, Value: 4})
+	if _, _, err := Remove(records, "aaaaaaa"); !errors.Is(err, ErrAmbiguousHash) {
+		t.Errorf("expected ambiguous hash error, got %v", err)
+	}
+}
+
+// testOutV2 is testOut with the value renamed count.
+type testOutV2 struct {
+	Entry
+	Count int `json:"count"`
+}
+
+func (r *testOutV2) Metrics() []Metric {
+	return []Metric{{Name: "count", Value: float64(r.Count)}}
+}
+
+func (*testOutV2) SchemaVersion() int { return 2 }
+
+func TestMigrate(t *testing.T) {
+	legacy := `[{"commit":"aaaaaaa","datetime":"2024-01-01T00:00:00Z","value":12345678901234567}]`
+
+	// the legacy array is read as the first version.
+	if _, err := Decode[*testOut](strings.NewReader(legacy)); err != nil {
+		t.Fatalf("decode legacy: %v", err)
+	}
+	if _, err := Decode[*testOutV2](strings.NewReader(legacy)); !errors.Is(err, ErrOutdated) {
+		t.Fatalf("expected outdated error, got %v", err)
+	}
+
+	steps := []Migration{{
+		From: 1,
+		Migrate: func(entry map[string]any) error {
+			entry["count"] = entry["value"]
+			delete(entry, "value")
+			return nil
+		},
+	}}
+
+	var out bytes.Buffer
+	from, to, err := Migrate(&out, strings.NewReader(legacy), steps)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if from != 1 || to != 2 {
+		t.Errorf("unexpected versions %d -> %d", from, to)
+	}
+
+	b := out.Bytes()
+	res, err := Decode[*testOutV2](bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode migrated: %v", err)
+	}
+	if len(res) != 1 || res[0].Count != 12345678901234567 {
+		t.Fatalf("unexpected records %+v", res)
+	}
+	if _, err := Decode[*testOut](bytes.NewReader(b)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected unsupported version error, got %v", err)
+	}
+
+	// the migration is idempotent.
+	out.Reset()
+	if from, to, err = Migrate(&out, bytes.NewReader(b), steps); err != nil || from != 2 || to != 2 {
+		t.Errorf("unexpected second migration %d -> %d: %v", from, to, err)
+	}
+
+	// generic records are encoded with their version.
+	records, err := DecodeRecords[*testOutV2](bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode records: %v", err)
+	}
+	out.Reset()
+	if err := Encode(&out, records); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), `{"version":2,`) {
+		t.Errorf("unexpected encoded history %s", out.String())
+	}
+}
+
+func TestDecodeNull(t *testing.T) {
+	all := `[{"commit":"aaaaaaa","datetime":"2024-01-01T00:00:00Z","value":1},null]`
+
+	if _, err := Decode[*testOut](strings.NewReader(all)); !errors.Is(err, ErrNullRecord) {
+		t.Errorf("expected null record error, got %v", err)
+	}
+	if _, err := DecodeRecords[*testOut](strings.NewReader(`{"version":1,"entries":[null]}`)); !errors.Is(err, ErrNullRecord) {
+		t.Errorf("expected null record error, got %v", err)
+	}
+}
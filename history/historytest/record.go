@@ -0,0 +1,37 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package historytest provides a history record for tests.
+package historytest
+
+import (
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+)
+
+// Record is a history record with arbitrary metrics.
+type Record struct {
+	history.Entry
+	Values []history.Metric `json:"metrics,omitempty"`
+}
+
+// Metrics implements history.Record.
+func (r *Record) Metrics() []history.Metric {
+	return append([]history.Metric(nil), r.Values...)
+}
+
+// New returns the record of the commit with the metrics.
+func New(hash git.CommitHash, metrics ...history.Metric) *Record {
+	return &Record{Entry: history.Entry{Hash: hash}, Values: metrics}
+}
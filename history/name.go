@@ -0,0 +1,88 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+)
+
+var ErrBadName = errors.New("bad result name")
+
+const nameTimeFormat = "2006-01-02_15-04"
+
+// ResultName identifies a single result file stored next to a history:
+// <date>_<time>_<hash>.json for the first run of a commit, then
+// <date>_<time>_<hash>_<run>.json for the next runs.
+type ResultName struct {
+	Time time.Time
+	Hash git.CommitHash
+	// Run starts at 1.
+	Run int
+}
+
+func (n ResultName) String() string {
+	if n.Run > 1 {
+		return fmt.Sprintf("%s_%s_%d.json", n.Time.Format(nameTimeFormat), n.Hash, n.Run)
+	}
+	return fmt.Sprintf("%s_%s.json", n.Time.Format(nameTimeFormat), n.Hash)
+}
+
+// Before orders the names by time, commit and run.
+func (n ResultName) Before(o ResultName) bool {
+	if !n.Time.Equal(o.Time) {
+		return n.Time.Before(o.Time)
+	}
+	if n.Hash != o.Hash {
+		return n.Hash < o.Hash
+	}
+	return n.Run < o.Run
+}
+
+// ParseResultName parses the base name of a result file.
+// A suffix after the hash is ignored unless it's a run number.
+func ParseResultName(name string) (ResultName, error) {
+	name = strings.TrimSuffix(name, path.Ext(name))
+
+	parts := strings.SplitN(name, "_", 4)
+	if len(parts) < 3 {
+		return ResultName{}, fmt.Errorf("%w: %q", ErrBadName, name)
+	}
+
+	t, err := time.Parse(nameTimeFormat, parts[0]+"_"+parts[1])
+	if err != nil {
+		return ResultName{}, fmt.Errorf("%w: %q: %w", ErrBadName, name, err)
+	}
+
+	hash, err := git.ParseCommitHash(parts[2])
+	if err != nil {
+		return ResultName{}, fmt.Errorf("%w: %q: %w", ErrBadName, name, err)
+	}
+
+	n := ResultName{Time: t, Hash: hash, Run: 1}
+	if len(parts) == 4 {
+		if run, err := strconv.Atoi(parts[3]); err == nil && run > 1 {
+			n.Run = run
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"github.com/lightpanda-io/perf-fmt/stats"
+)
+
+// Metric is a named value of a record.
+// The name is the dot separated path of the value in the record, without
+// the data prefix, e.g. browser.duration.
+type Metric struct {
+	Name  string
+	Value float64
+	// HigherIsBetter is set for metrics improving when they increase, like
+	// passing tests. Durations and memory usages are lower is better.
+	HigherIsBetter bool
+}
+
+// AddRun merges the run's metrics into the record's samples.
+// The record's own fields keep the values of its first run.
+func AddRun(rec, run Record) {
+	e := rec.Meta()
+
+	if e.Runs == 0 {
+		// the record contains a single run, its values are the first samples.
+		e.Runs = 1
+		e.Samples = make(map[string][]float64)
+		for _, m := range rec.Metrics() {
+			e.Samples[m.Name] = []float64{m.Value}
+		}
+	}
+
+	e.Runs++
+	for _, m := range run.Metrics() {
+		e.Samples[m.Name] = append(e.Samples[m.Name], m.Value)
+	}
+}
+
+// Values returns the record's metric values.
+// For records with several runs, the median of the samples is used.
+func Values(rec Record) []Metric {
+	metrics := rec.Metrics()
+
+	e := rec.Meta()
+	if e.Runs < 2 {
+		return metrics
+	}
+
+	for i, m := range metrics {
+		if samples, ok := e.Samples[m.Name]; ok {
+			metrics[i].Value = stats.Median(samples)
+		}
+	}
+
+	return metrics
+}
+
+func (e *Entry) computeStats() {
+	if len(e.Samples) == 0 {
+		e.Stats = nil
+		return
+	}
+
+	e.Stats = make(map[string]stats.Summary, len(e.Samples))
+	for name, samples := range e.Samples {
+		e.Stats[name] = stats.Summarize(samples)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// SortTime returns the time used to order the record: the commit time if
+// known, the ingestion time otherwise.
+func (e *Entry) SortTime() time.Time {
+	if !e.CommitTime.IsZero() {
+		return e.CommitTime
+	}
+	return e.Time
+}
+
+// Sort reorders the records by commit topology: a commit is always placed
+// after its parents present in the history. Unrelated commits are ordered by
+// SortTime.
+func Sort[Out Record](allres []Out) {
+	sort.SliceStable(allres, func(i, j int) bool {
+		return allres[i].Meta().SortTime().Before(allres[j].Meta().SortTime())
+	})
+
+	// index the records by short hash to find the parents, full and
+	// abbreviated hashes can be mixed in the history.
+	index := make(map[string][]int, len(allres))
+	for i, v := range allres {
+		h := string(v.Meta().Hash.Short())
+		index[h] = append(index[h], i)
+	}
+
+	// children lists the records waiting for each record.
+	children := make([][]int, len(allres))
+	pending := make([]int, len(allres))
+	for i, v := range allres {
+		for _, p := range v.Meta().Parents {
+			for _, j := range index[string(p.Short())] {
+				if j != i && allres[j].Meta().Hash.Matches(p) {
+					children[j] = append(children[j], i)
+					pending[i]++
+				}
+			}
+		}
+	}
+
+	// Kahn's algorithm, picking the ready record with the smallest time
+	// order first.
+	ready := &intHeap{}
+	for i := range allres {
+		if pending[i] == 0 {
+			heap.Push(ready, i)
+		}
+	}
+
+	order := make([]int, 0, len(allres))
+	for ready.Len() > 0 {
+		i := heap.Pop(ready).(int)
+		order = append(order, i)
+		for _, c := range children[i] {
+			pending[c]--
+			if pending[c] == 0 {
+				heap.Push(ready, c)
+			}
+		}
+	}
+
+	// a cycle can only come from inconsistent data, keep the time order for
+	// the remaining records.
+	if len(order) < len(allres) {
+		for i := range allres {
+			if pending[i] > 0 {
+				order = append(order, i)
+			}
+		}
+	}
+
+	sorted := make([]Out, len(allres))
+	for i, j := range order {
+		sorted[i] = allres[j]
+	}
+	copy(allres, sorted)
+}
+
+type intHeap []int
+
+func (h intHeap) Len() int           { return len(h) }
+func (h intHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *intHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *intHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,160 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+var (
+	ErrOutdated           = errors.New("outdated history version")
+	ErrUnsupportedVersion = errors.New("unsupported history version")
+)
+
+// LegacyVersion is the version of the histories stored as a bare JSON
+// array, before the versioned envelope.
+const LegacyVersion = 1
+
+// Versioned is implemented by the records whose schema changed since the
+// legacy version. The version is bumped with each change and a migration
+// step is registered with the source.
+type Versioned interface {
+	SchemaVersion() int
+}
+
+// envelope is the stored history: {"version":N,"entries":[...]}.
+type envelope[T any] struct {
+	Version int `json:"version"`
+	Entries []T `json:"entries"`
+}
+
+// schemaVersion returns the version of the Out records.
+// The version of generic records is read from the first one.
+func schemaVersion[Out Record](allres []Out) int {
+	var zero Out
+	if v, ok := any(zero).(Versioned); ok {
+		return v.SchemaVersion()
+	}
+	if len(allres) > 0 {
+		if v, ok := any(allres[0]).(Versioned); ok {
+			return v.SchemaVersion()
+		}
+	}
+
+	return LegacyVersion
+}
+
+// decodeRaw decodes the version and the raw entries of a legacy array or of
+// an envelope. An empty reader returns no entries.
+func decodeRaw(r io.Reader) (int, json.RawMessage, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("read all: %w", err)
+	}
+
+	b = bytes.TrimSpace(b)
+	switch {
+	case len(b) == 0:
+		return LegacyVersion, nil, nil
+	case b[0] == '[':
+		return LegacyVersion, b, nil
+	}
+
+	var env envelope[json.RawMessage]
+	if err := json.Unmarshal(b, &env); err != nil {
+		return 0, nil, fmt.Errorf("decode all: %w", err)
+	}
+	if env.Version < LegacyVersion {
+		return 0, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, env.Version)
+	}
+
+	entries, err := json.Marshal(env.Entries)
+	if err != nil {
+		return 0, nil, fmt.Errorf("encode entries: %w", err)
+	}
+
+	return env.Version, entries, nil
+}
+
+// checkVersion returns an error if the stored version differs from the
+// records one. An empty history has no version.
+func checkVersion(version, want int, entries json.RawMessage) error {
+	if version == want || len(entries) == 0 || bytes.Equal(entries, []byte("[]")) {
+		return nil
+	}
+	if version < want {
+		return fmt.Errorf("%w: %d, expected %d, run the migrate command", ErrOutdated, version, want)
+	}
+
+	return fmt.Errorf("%w: %d, expected %d", ErrUnsupportedVersion, version, want)
+}
+
+// Migration upgrades a history entry from the version From to From+1.
+// The entry is the decoded JSON object, numbers are json.Number.
+type Migration struct {
+	From        int
+	Description string
+	Migrate     func(entry map[string]any) error
+}
+
+// Migrate applies the steps to the history read from r and writes the
+// upgraded history envelope into w.
+// It returns the versions before and after the migration.
+func Migrate(w io.Writer, r io.Reader, steps []Migration) (from, to int, err error) {
+	from, raw, err := decodeRaw(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var entries []map[string]any
+	if len(raw) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&entries); err != nil {
+			return 0, 0, fmt.Errorf("decode entries: %w", err)
+		}
+	}
+
+	steps = slices.Clone(steps)
+	slices.SortStableFunc(steps, func(a, b Migration) int { return cmp.Compare(a.From, b.From) })
+
+	to = from
+	for _, step := range steps {
+		if step.From != to {
+			continue
+		}
+		for i, entry := range entries {
+			if err := step.Migrate(entry); err != nil {
+				return 0, 0, fmt.Errorf("migrate entry %d to version %d: %w", i, to+1, err)
+			}
+		}
+		to++
+	}
+
+	if entries == nil {
+		entries = []map[string]any{}
+	}
+	if err := json.NewEncoder(w).Encode(envelope[map[string]any]{Version: to, Entries: entries}); err != nil {
+		return 0, 0, fmt.Errorf("encode out: %w", err)
+	}
+
+	return from, to, nil
+}
@@ -16,14 +16,11 @@ package hyperfine
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
-	"sort"
-	"time"
 
-	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/sources"
 )
 
 type InResult struct {
@@ -31,72 +28,66 @@ type InResult struct {
 		Mean float64 `json:"mean"`
 		Min  float64 `json:"min"`
 		Max  float64 `json:"max"`
-	} `json:"results"`
+	} `json:"results" schema:"required"`
 }
 
 type OutResult struct {
-	Hash git.CommitHash `json:"commit"`
-	Time time.Time      `json:"datetime"`
-	Mean float64        `json:"mean"`
-	Min  float64        `json:"min"`
-	Max  float64        `json:"max"`
+	history.Entry
+	Mean float64 `json:"mean"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
 }
 
-type Append struct{}
+func (r *OutResult) Metrics() []history.Metric {
+	return []history.Metric{
+		{Name: "mean", Value: r.Mean},
+		{Name: "min", Value: r.Min},
+		{Name: "max", Value: r.Max},
+	}
+}
+
+// Name is the source's registered name.
+const Name = "hyperfine"
+
+func init() {
+	sources.Register(sources.Info{
+		Name:        Name,
+		Description: "lightpanda browser cold start.",
+		Path:        "hyperfine",
+		In:          InResult{},
+		Out:         &OutResult{},
+		New:         func(p history.Policy) sources.Source { return &Append{OnDuplicate: p} },
+	})
+}
+
+type Append struct {
+	// OnDuplicate is the policy applied when the commit already exists.
+	OnDuplicate history.Policy
+}
 
 func (a *Append) Append(
 	ctx context.Context,
-	hash git.CommitHash, datetime time.Time,
+	e history.Entry,
 	out io.Writer,
 	all io.Reader, one io.Reader,
 ) error {
-	// decode one input
-	var inr InResult
-	dec := json.NewDecoder(one)
+	return history.Append(e, a.OnDuplicate, out, all, one, convert)
+}
 
-	if err := dec.Decode(&inr); err != nil {
-		return fmt.Errorf("decode one: %w", err)
-	}
+// Decode decodes the history.
+func (a *Append) Decode(r io.Reader) ([]history.Record, error) {
+	return history.DecodeRecords[*OutResult](r)
+}
 
+func convert(inr InResult, e history.Entry) (*OutResult, error) {
 	if len(inr.Results) != 1 {
-		return errors.New("unexpected results size")
-	}
-
-	// decode all input
-	var allres []OutResult
-	dec = json.NewDecoder(all)
-
-	if err := dec.Decode(&allres); err != nil && !errors.Is(err, io.EOF) {
-		return fmt.Errorf("decode all: %w", err)
-	}
-
-	// search if the commit already exists in the all results to avoid duplication.
-	for _, v := range allres {
-		if hash == v.Hash {
-			return errors.New("hash exists")
-		}
-	}
-
-	outres := OutResult{
-		Hash: hash,
-		Time: datetime,
-		Mean: inr.Results[0].Mean,
-		Min:  inr.Results[0].Min,
-		Max:  inr.Results[0].Max,
-	}
-
-	allres = append(allres, outres)
-
-	// reorder slice
-	sort.Slice(allres, func(i, j int) bool {
-		return allres[i].Time.Before(allres[j].Time)
-	})
-
-	// encode output
-	enc := json.NewEncoder(out)
-	if err := enc.Encode(allres); err != nil {
-		return fmt.Errorf("encode out: %w", err)
+		return nil, errors.New("unexpected results size")
 	}
 
-	return nil
+	return &OutResult{
+		Entry: e,
+		Mean:  inr.Results[0].Mean,
+		Min:   inr.Results[0].Min,
+		Max:   inr.Results[0].Max,
+	}, nil
 }
@@ -15,7 +15,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"flag"
@@ -23,23 +22,26 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	browserbench "github.com/lightpanda-io/perf-fmt/bench/browser"
-	jsrbench "github.com/lightpanda-io/perf-fmt/bench/jsruntime"
-	"github.com/lightpanda-io/perf-fmt/cdp"
-	"github.com/lightpanda-io/perf-fmt/cf"
+	"github.com/lightpanda-io/perf-fmt/config"
 	"github.com/lightpanda-io/perf-fmt/git"
-	"github.com/lightpanda-io/perf-fmt/hyperfine"
-	"github.com/lightpanda-io/perf-fmt/s3"
-	"github.com/lightpanda-io/perf-fmt/wpt"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/sources"
+
+	// register the sources.
+	_ "github.com/lightpanda-io/perf-fmt/bench/browser"
+	_ "github.com/lightpanda-io/perf-fmt/bench/jsruntime"
+	_ "github.com/lightpanda-io/perf-fmt/cdp"
+	_ "github.com/lightpanda-io/perf-fmt/hyperfine"
+	_ "github.com/lightpanda-io/perf-fmt/wpt"
 )
 
 const (
-	exitOK   = 0
-	exitFail = 1
+	exitOK         = 0
+	exitFail       = 1
+	exitRegression = 2
 )
 
 // main starts interruptable context and runs the program.
@@ -47,9 +49,12 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
-	err := run(ctx, os.Args, os.Stdout, os.Stderr)
+	err := run(ctx, os.Args, os.Getenv, os.Stdin, os.Stdout, os.Stderr)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
+		if errors.Is(err, errRegression) {
+			os.Exit(exitRegression)
+		}
 		os.Exit(exitFail)
 	}
 
@@ -57,42 +62,124 @@ func main() {
 }
 
 const (
-	SourceBenchJSRuntime = "bench-jsruntime"
-	SourceBenchBrowser   = "bench-browser"
-	SourceWPT            = "wpt"
-	SourceCDP            = "cdp"
-	SourceHyperfine      = "hyperfine"
-
 	AWSRegion = "eu-west-3"
 	AWSBucket = "lpd-perf"
 
-	PathBenchJSRuntime = "bench/jsruntime"
-	PathBenchBrowser   = "bench/browser"
-	PathCDP            = "cdp"
-	PathWPT            = "wpt"
-	PathHyperfine      = "hyperfine"
+	CmdAppend     = "append"
+	CmdCheck      = "check"
+	CmdAnalyze    = "analyze"
+	CmdCompare    = "compare"
+	CmdSummary    = "summary"
+	CmdExport     = "export"
+	CmdServe      = "serve"
+	CmdSources    = "sources"
+	CmdRebuild    = "rebuild"
+	CmdBackfill   = "backfill"
+	CmdDelete     = "delete"
+	CmdQuarantine = "quarantine"
+	CmdMigrate    = "migrate"
+	CmdSchema     = "schema"
+	CmdValidate   = "validate"
 )
 
-// run configures the flags and starts the HTTP API server.
-func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
-	// declare runtime flag parameters.
-	flags := flag.NewFlagSet(args[0], flag.ExitOnError)
+var errEnvMismatch = errors.New("runner environments differ")
+
+// runFunc runs a command with its arguments.
+type runFunc func(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+// command is a perf-fmt sub command.
+type command struct {
+	name string
+	// desc is the one line description of the command.
+	desc string
+	run  runFunc
+}
+
+// commands lists the sub commands.
+var commands = []command{
+	{CmdAppend, "append a result to a source's history", runAppend},
+	{CmdCheck, "compare a stored result with the previous ones", runCheck},
+	{CmdAnalyze, "list the significant changes of a source's history", runAnalyze},
+	{CmdCompare, "print the metrics deltas between two commits", runCompare},
+	{CmdSummary, "render a Markdown report of a commit for all sources", runSummary},
+	{CmdExport, "write a source's history in JSON or CSV", runExport},
+	{CmdRebuild, "rebuild a source's history from the single results", runRebuild},
+	{CmdBackfill, "merge a dir of raw results into a source's history", runBackfill},
+	{CmdDelete, "remove a commit's record from a source's history", runDelete},
+	{CmdQuarantine, "exclude a commit's record from the baselines", runQuarantine},
+	{CmdMigrate, "upgrade the stored histories to the current version", runMigrate},
+	{CmdSchema, "print the JSON schema of a source's results", runSchema},
+	{CmdValidate, "check result files against a source's JSON schema", runValidate},
+	{CmdServe, "serve the histories over HTTP", runServe},
+	{CmdSources, "list the available sources", runSources},
+}
+
+// lookupCommand returns the command by name.
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// globalFlags are the options of all the commands.
+type globalFlags struct {
+	configPath string
+	dev        bool
+	prefix     string
+	storeURL   string
+	repo       string
+	branch     string
+	mainBranch string
+	strictEnv  bool
+}
+
+func (g *globalFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&g.configPath, "config", "", "configuration file, default to "+config.DefaultFile+" if it exists")
+	flags.BoolVar(&g.dev, "dev", false, "use dev/ dir storage prefix")
+	flags.StringVar(&g.prefix, "prefix", "", "prefix of the sources' paths, overrides the configured one")
+	flags.StringVar(&g.storeURL, "store", "", "storage url: s3://bucket/prefix, file:///dir or mem://")
+	flags.StringVar(&g.repo, "repo", "", "local git repository used to resolve commit refs, dates and parents")
+	flags.StringVar(&g.branch, "branch", "", "commit's branch name, also selects the history read by the commands, default to the GitHub Actions branch, then the --repo current branch")
+	flags.StringVar(&g.mainBranch, "main-branch", "main", "branch using the main history, other branches have their own history")
+	flags.BoolVar(&g.strictEnv, "strict-env", false, "refuse to compare results from different runner environments")
+}
 
-	var (
-		dev = flags.Bool("dev", false, "use dev/ dir storage prefix")
-	)
+// run parses the global flags and runs the command.
+// The CI env vars are read with getenv.
+func run(ctx context.Context, args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var g globalFlags
+	global := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	g.register(global)
 
 	// usage func declaration.
 	exec := args[0]
-	flags.Usage = func() {
-		fmt.Fprintf(stderr, "usage: %s <source> <commit> <result.json>\n", exec)
+	usage := func() {
+		fmt.Fprintf(stderr, "usage: %s [options] <command> [command options] <args>\n", exec)
+		fmt.Fprintf(stderr, "       %s [options] <source> <commit> <result.json>...\n", exec)
 		fmt.Fprintf(stderr, "\nRead, format and save performance results.\n")
+		fmt.Fprintf(stderr, "The second form is a shortcut of the %s command, it also accepts the\n", CmdAppend)
+		fmt.Fprintf(stderr, "%s options before the source.\n", CmdAppend)
+		fmt.Fprintf(stderr, "\nThe commands are:\n")
+		for _, c := range commands {
+			fmt.Fprintf(stderr, "\t%s\t%s\n", c.name, c.desc)
+		}
+		fmt.Fprintf(stderr, "\nRun '%s <command> -h' for the command's help.\n", exec)
 		fmt.Fprintf(stderr, "\nThe sources avalaible are:\n")
-		fmt.Fprintf(stderr, "\t%s\tDEPRECATED jsruntime-lib benchmark json result.\n", SourceBenchJSRuntime)
-		fmt.Fprintf(stderr, "\t%s\tlightpanda browser test benchmark json result.\n", SourceBenchBrowser)
-		fmt.Fprintf(stderr, "\t%s\tlightpanda browser CDP benchmark json result.\n", SourceCDP)
-		fmt.Fprintf(stderr, "\t%s\tlightpanda browser WPT test result.\n", SourceWPT)
-		fmt.Fprintf(stderr, "\t%s\tlightpanda browser cold start.\n", SourceHyperfine)
+		for _, info := range sources.All() {
+			fmt.Fprintf(stderr, "\t%s\t%s\n", info.Name, describe(info))
+		}
+		fmt.Fprintf(stderr, "\nThe options are:\n")
+		global.SetOutput(stderr)
+		global.PrintDefaults()
+		global.SetOutput(io.Discard)
+		fmt.Fprintf(stderr, "\nThe %s configuration file sets the store, the region, the prefix,\n", config.DefaultFile)
+		fmt.Fprintf(stderr, "the sources' paths and thresholds and the CDN, env vars and options override it.\n")
+		fmt.Fprintf(stderr, "It also declares custom sources mapping JMESPath expressions to metrics.\n")
+		fmt.Fprintf(stderr, "\nBy default the results are stored in the s3://$AWS_BUCKET store.\n")
 		fmt.Fprintf(stderr, "\nTo upload data in AWS S3, the program uses env var:\n")
 		fmt.Fprintf(stderr, "\tAWS_ACCESS_KEY_ID\t\trequired\n")
 		fmt.Fprintf(stderr, "\tAWS_SECRET_ACCESS_KEY\t\trequired\n")
@@ -100,115 +187,102 @@ func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
 		fmt.Fprintf(stderr, "\tAWS_BUCKET\t\t\tdefault value: %s\n", AWSBucket)
 		fmt.Fprintf(stderr, "\tAWS_CF_DISTRIBUTION\n")
 	}
-	if err := flags.Parse(args[1:]); err != nil {
-		return err
+	// the legacy append form also accepts the append options before the
+	// source, it's parsed with its own flag set.
+	aopts := newAppendOptions(getenv)
+	global.Usage = usage
+	flags := global
+	err := global.Parse(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		// the usage is already printed.
+		return nil
 	}
-
-	args = flags.Args()
-	if len(args) != 3 {
-		flags.Usage()
-		return errors.New("bad arguments")
+	if _, ok := lookupCommand(global.Arg(0)); err != nil || !ok {
+		flags = flag.NewFlagSet(args[0], flag.ExitOnError)
+		flags.SetOutput(stderr)
+		flags.Usage = usage
+		g.register(flags)
+		aopts.register(flags)
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if _, ok := lookupCommand(flags.Arg(0)); ok {
+			usage()
+			return fmt.Errorf("the %s options are not accepted before the %s command", CmdAppend, flags.Arg(0))
+		}
 	}
 
-	var (
-		append Append
-		path   string
-	)
-
-	switch args[0] {
-	case SourceBenchJSRuntime:
-		append = &jsrbench.Append{}
-		path = PathBenchJSRuntime
-	case SourceBenchBrowser:
-		append = &browserbench.Append{}
-		path = PathBenchBrowser
-	case SourceCDP:
-		append = &cdp.Append{}
-		path = PathCDP
-	case SourceWPT:
-		append = &wpt.Append{}
-		path = PathWPT
-	case SourceHyperfine:
-		append = &hyperfine.Append{}
-		path = PathHyperfine
-	default:
-		flags.Usage()
-		return errors.New("bad source")
+	cfg, err := config.Load(g.configPath)
+	if err != nil {
+		return err
 	}
-
-	// If dev flag is active, use the `dev/` dir prefix.
-	if *dev {
-		path = "dev/" + path
-		fmt.Fprintf(os.Stderr, "⚠️  Dev mode enabled, result will be stored in %q\n", path)
+	// flags take precedence over the configuration.
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["main-branch"] && cfg.MainBranch != "" {
+		g.mainBranch = cfg.MainBranch
 	}
-
-	hash := git.CommitHash(args[1])
-	// TODO check commit format
-
-	now := time.Now().UTC()
-
-	// open one
-	one, err := os.Open(args[2])
-	if err != nil {
-		return fmt.Errorf("open input file: %w", err)
+	if !set["prefix"] {
+		g.prefix = cfg.Prefix
 	}
-	defer one.Close()
 
-	session, err := session.NewSession()
+	// the same branch is used to write and to read the histories.
+	br, err := resolveBranch(ctx, g.branch, g.repo, getenv)
 	if err != nil {
-		return fmt.Errorf("new aws session: %w", err)
+		return err
 	}
 
-	// prepare S3 connection
-	// set default env region if not already set.
-	if _, ok := os.LookupEnv("AWS_REGION"); !ok {
-		os.Setenv("AWS_REGION", AWSRegion)
+	opts := options{
+		dev:        g.dev,
+		prefix:     g.prefix,
+		cfg:        cfg,
+		url:        g.storeURL,
+		repo:       g.repo,
+		branch:     br,
+		mainBranch: g.mainBranch,
+		strictEnv:  g.strictEnv,
+		append:     aopts,
+		getenv:     getenv,
 	}
-	fio := s3.NewS3IO(session, env("AWS_BUCKET", AWSBucket), path+"/history.json", "application/json")
-
-	// pull the all
-	all, err := fio.Pull(ctx)
-	if err != nil {
-		return fmt.Errorf("pull all files: %w", err)
+	if err := opts.checkConfig(); err != nil {
+		return err
 	}
-	defer all.Close()
 
-	var out bytes.Buffer
-
-	// append input to output
-	if err := append.Append(ctx, hash, now, &out, all, one); err != nil {
-		return fmt.Errorf("append result: %w", err)
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("missing command")
 	}
 
-	// push output
-	if err := fio.Push(ctx, &out); err != nil {
-		return fmt.Errorf("push result: %w", err)
+	if c, ok := lookupCommand(args[0]); ok {
+		return c.run(ctx, exec, opts, args[1:], stdin, stdout, stderr)
 	}
 
-	// push the single result file
-	// Reset the file handler to the begining of the file
-	if _, err := one.Seek(0, 0); err != nil {
-		return fmt.Errorf("reset file: %w", err)
+	// legacy append form.
+	if len(args) < 3 {
+		flags.Usage()
+		return errors.New("bad arguments")
 	}
-
-	filename := fmt.Sprintf("%s_%v.json", now.Format("2006-01-02_15-04"), hash)
-	fio = s3.NewS3IO(session, env("AWS_BUCKET", AWSBucket), path+"/"+filename, "application/json")
-
-	// push output
-	if err := fio.Push(ctx, one); err != nil {
-		return fmt.Errorf("push single result : %w", err)
+	if _, _, err := opts.lookupSource(args[0], history.PolicyFail); err != nil {
+		flags.Usage()
+		return err
 	}
 
-	// optionally invalide the cache for history
-	if did := os.Getenv("AWS_CF_DISTRIBUTION"); did != "" {
-		cf := cf.NewCloudFrontCache(session, did)
-		// Cloudfront requires an absolute path.
-		if err := cf.Invalidate(ctx, "/"+path+"/history.json"); err != nil {
-			return fmt.Errorf("invalidate cache: %w", err)
+	return runAppend(ctx, exec, opts, args, stdin, stdout, stderr)
+}
+
+// parseParents parses a comma separated list of commits.
+func parseParents(s string) ([]git.CommitHash, error) {
+	var parents []git.CommitHash
+	for _, p := range strings.Split(s, ",") {
+		parent, err := git.ParseCommitHash(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("bad parent: %w", err)
 		}
+		parents = append(parents, parent)
 	}
 
-	return nil
+	return parents, nil
 }
 
 func env(key, dflt string) string {
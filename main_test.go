@@ -0,0 +1,774 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/audit"
+	"github.com/lightpanda-io/perf-fmt/cdp"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/s3/s3test"
+	"github.com/lightpanda-io/perf-fmt/store"
+)
+
+// noEnv is the empty environment of the tests, the CI env vars of the test
+// process must not change the histories' paths.
+func noEnv(string) string { return "" }
+
+// newFileStore returns a temp dir store and its url.
+// The GITHUB_* env vars of the test process are cleared for the test.
+func newFileStore(t *testing.T) (dir, storeURL string) {
+	t.Helper()
+
+	for _, kv := range os.Environ() {
+		if k, _, _ := strings.Cut(kv, "="); strings.HasPrefix(k, "GITHUB_") {
+			t.Setenv(k, "")
+			os.Unsetenv(k)
+		}
+	}
+
+	dir = t.TempDir()
+	return dir, "file://" + dir
+}
+
+// cdpResult returns a cdp result with the duration_avg.
+func cdpResult(avg int) []byte {
+	return []byte(`{"duration_total":100,"duration_avg":` + strconv.Itoa(avg) + `,"mem_peak":42,"cg_mem_peak":43}`)
+}
+
+// writeResult writes a cdp result in a temp file and returns its path.
+func writeResult(t *testing.T) string {
+	t.Helper()
+	return writeFile(t, t.TempDir(), "result.json", cdpResult(10))
+}
+
+// writeFile writes the data in the name file of the dir and returns its
+// path.
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunFileStore(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	in := writeResult(t)
+
+	for _, hash := range []string{"aaaaaaa", "bbbbbbb"} {
+		err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "cdp", hash, in}, noEnv, nil, io.Discard, io.Discard)
+		if err != nil {
+			t.Fatalf("run %s: %v", hash, err)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "cdp", "history.json"))
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+
+	all, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+
+	if len(all) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(all))
+	}
+	if all[0].Hash != "aaaaaaa" || all[1].Hash != "bbbbbbb" {
+		t.Errorf("unexpected hashes %q %q", all[0].Hash, all[1].Hash)
+	}
+	if all[1].DurationAVG != 10 {
+		t.Errorf("unexpected duration avg %d", all[1].DurationAVG)
+	}
+
+	// the single result is stored next to the history.
+	files, err := filepath.Glob(filepath.Join(dir, "cdp", "*_aaaaaaa.json"))
+	if err != nil || len(files) != 1 {
+		t.Errorf("single result not found: %v", files)
+	}
+}
+
+func TestRunMultipleResults(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	in := t.TempDir()
+	for i, avg := range []int{10, 12, 14} {
+		writeFile(t, in, "run"+strconv.Itoa(i)+".json", cdpResult(avg))
+	}
+
+	err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "cdp", "aaaaaaa", filepath.Join(in, "run*.json")}, noEnv, nil, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "cdp", "history.json"))
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+
+	all, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(all) != 1 || all[0].Runs != 3 {
+		t.Fatalf("expected one record of 3 runs, got %+v", all)
+	}
+
+	// each result is stored.
+	files, err := filepath.Glob(filepath.Join(dir, "cdp", "*_aaaaaaa*.json"))
+	if err != nil || len(files) != 3 {
+		t.Errorf("single results not found: %v", files)
+	}
+}
+
+func TestRunKeepBatch(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	in := writeResult(t)
+
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "cdp", "aaaaaaa", in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// the existing commit ignores the whole batch, or rejects it.
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "--on-duplicate", "keep", "cdp", "aaaaaaa", in, in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run keep: %v", err)
+	}
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "cdp", "aaaaaaa", in, in}, noEnv, nil, io.Discard, io.Discard); !errors.Is(err, history.ErrHashExists) {
+		t.Fatalf("expected hash exists error, got %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "cdp", "history.json"))
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	all, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(all) != 1 || all[0].Runs != 0 {
+		t.Fatalf("unexpected history %+v", all)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "cdp", "*_aaaaaaa*.json"))
+	if err != nil || len(files) != 1 {
+		t.Errorf("unexpected single results %v", files)
+	}
+}
+
+func TestRunReruns(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	in := writeResult(t)
+
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "cdp", "aaaaaaa", in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "--on-duplicate", "append-run", "cdp", "aaaaaaa", in, in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run rerun: %v", err)
+	}
+
+	// the reruns' single results follow the stored runs.
+	files, err := filepath.Glob(filepath.Join(dir, "cdp", "*_aaaaaaa*.json"))
+	if err != nil || len(files) != 3 {
+		t.Fatalf("unexpected single results %v", files)
+	}
+	for i, suffix := range []string{"_aaaaaaa.json", "_aaaaaaa_2.json", "_aaaaaaa_3.json"} {
+		if !strings.HasSuffix(files[i], suffix) {
+			t.Errorf("expected a %s single result, got %s", suffix, files[i])
+		}
+	}
+
+	readHistory := func() []*cdp.OutResult {
+		b, err := os.ReadFile(filepath.Join(dir, "cdp", "history.json"))
+		if err != nil {
+			t.Fatalf("read history: %v", err)
+		}
+		all, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("decode history: %v", err)
+		}
+		return all
+	}
+
+	// the rebuild merges the reruns and keeps the stored time.
+	before := readHistory()
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "rebuild", "cdp"}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run rebuild: %v", err)
+	}
+	all := readHistory()
+	if len(all) != 1 || all[0].Runs != 3 || !all[0].Time.Equal(before[0].Time) {
+		t.Fatalf("unexpected rebuilt history %+v", all)
+	}
+
+	// a commit added again after its deletion is rebuilt, even in the same
+	// minute.
+	for _, args := range [][]string{
+		{"delete", "cdp", "aaaaaaa"},
+		{"cdp", "aaaaaaa", in},
+		{"rebuild", "cdp"},
+	} {
+		if err := run(context.Background(), append([]string{"perf-fmt", "--store", storeURL}, args...), noEnv, nil, io.Discard, io.Discard); err != nil {
+			t.Fatalf("run %s: %v", args[0], err)
+		}
+	}
+	if all := readHistory(); len(all) != 1 || all[0].Hash != "aaaaaaa" || all[0].Runs != 0 {
+		t.Fatalf("unexpected history after delete %+v", all)
+	}
+}
+
+func TestRunStdinAndLiteralNames(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	// a file named like a pattern is read as is.
+	in := writeFile(t, t.TempDir(), "res[1].json", cdpResult(10))
+	stdin := bytes.NewReader(cdpResult(12))
+
+	err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "cdp", "aaaaaaa", in, "-"}, noEnv, stdin, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "cdp", "history.json"))
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	all, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(all) != 1 || all[0].Runs != 2 || !slices.Equal(all[0].Samples["duration_avg"], []float64{10, 12}) {
+		t.Fatalf("unexpected history %+v", all)
+	}
+}
+
+func TestRunRebuild(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	in := writeResult(t)
+
+	for _, hash := range []string{"aaaaaaa", "bbbbbbb"} {
+		if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "--pr", "12", "cdp", hash, in, in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+			t.Fatalf("run %s: %v", hash, err)
+		}
+	}
+
+	readHistory := func() []*cdp.OutResult {
+		b, err := os.ReadFile(filepath.Join(dir, "cdp", "history.json"))
+		if err != nil {
+			t.Fatalf("read history: %v", err)
+		}
+
+		all, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("decode history: %v", err)
+		}
+		return all
+	}
+
+	// the metadata of the readable history are kept.
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "rebuild", "cdp"}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run rebuild: %v", err)
+	}
+	all := readHistory()
+	if len(all) != 2 || all[1].Hash != "bbbbbbb" || all[1].PR != 12 || all[1].Runs != 2 {
+		t.Fatalf("unexpected history %+v", all)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "cdp", "history.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "rebuild", "cdp"}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run rebuild: %v", err)
+	}
+	all = readHistory()
+	if len(all) != 2 || all[0].Hash != "aaaaaaa" || all[0].Runs != 2 {
+		t.Fatalf("unexpected history %+v", all)
+	}
+}
+
+func TestRunDeleteQuarantine(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	in := writeResult(t)
+
+	for _, hash := range []string{"aaaaaaa", "bbbbbbb", "ccccccc"} {
+		if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "cdp", hash, in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+			t.Fatalf("run %s: %v", hash, err)
+		}
+	}
+
+	readHistory := func() []*cdp.OutResult {
+		b, err := os.ReadFile(filepath.Join(dir, "cdp", "history.json"))
+		if err != nil {
+			t.Fatalf("read history: %v", err)
+		}
+
+		all, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("decode history: %v", err)
+		}
+		return all
+	}
+
+	for _, args := range [][]string{
+		{"delete", "cdp", "aaaaaaa", "--actor", "ci"},
+		{"quarantine", "cdp", "bbbbbbb", "--reason", "noisy runner"},
+	} {
+		if err := run(context.Background(), append([]string{"perf-fmt", "--store", storeURL}, args...), noEnv, nil, io.Discard, io.Discard); err != nil {
+			t.Fatalf("run %s: %v", args[0], err)
+		}
+	}
+
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "quarantine", "cdp", "ccccccc"}, noEnv, nil, io.Discard, io.Discard); err == nil {
+		t.Errorf("expected a missing reason error")
+	}
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "delete", "cdp", "ddddddd"}, noEnv, nil, io.Discard, io.Discard); !errors.Is(err, history.ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	all := readHistory()
+	if len(all) != 2 || all[0].Hash != "bbbbbbb" || all[0].Quarantine == nil || all[0].Quarantine.Reason != "noisy runner" {
+		t.Fatalf("unexpected history %+v", all)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "cdp", "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	events, err := audit.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode audit log: %v", err)
+	}
+	if len(events) != 2 || events[0].Action != audit.ActionDelete || events[0].Actor != "ci" || len(events[0].Record) == 0 {
+		t.Fatalf("unexpected audit log %+v", events)
+	}
+
+	// the export excludes the quarantined record by default.
+	for flag, expected := range map[string]int{"": 1, "--include-quarantined": 2} {
+		args := []string{"perf-fmt", "--store", storeURL, "export", "cdp"}
+		if flag != "" {
+			args = []string{"perf-fmt", "--store", storeURL, "export", flag, "cdp"}
+		}
+		var out bytes.Buffer
+		if err := run(context.Background(), args, noEnv, nil, &out, io.Discard); err != nil {
+			t.Fatalf("run export: %v", err)
+		}
+		exported, err := history.Decode[*cdp.OutResult](&out)
+		if err != nil || len(exported) != expected {
+			t.Errorf("export %q: expected %d records, got %d: %v", flag, expected, len(exported), err)
+		}
+	}
+
+	// the rebuild skips the deleted commit and keeps the quarantine.
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "rebuild", "cdp"}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run rebuild: %v", err)
+	}
+	all = readHistory()
+	if len(all) != 2 || all[0].Hash != "bbbbbbb" || all[0].Quarantine == nil {
+		t.Fatalf("unexpected rebuilt history %+v", all)
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	legacy := `[{"commit":"aaaaaaa","datetime":"2024-01-01T00:00:00Z",` +
+		`"duration_total":100,"duration_avg":10,"mem_peak":42,"cg_mem_peak":43}]`
+	if err := os.MkdirAll(filepath.Join(dir, "cdp"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	key := filepath.Join(dir, "cdp", "history.json")
+	if err := os.WriteFile(key, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "migrate", "--dry-run", "cdp"}, noEnv, nil, &out, io.Discard); err != nil {
+		t.Fatalf("run migrate dry run: %v", err)
+	}
+	if !strings.Contains(out.String(), "would migrate cdp/history.json from version 1 to 1") {
+		t.Errorf("unexpected dry run output %q", out.String())
+	}
+
+	// the legacy array is converted into a versioned history.
+	for _, want := range []string{"migrated from version 1 to 1", "is up to date"} {
+		out.Reset()
+		if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "migrate", "cdp"}, noEnv, nil, &out, io.Discard); err != nil {
+			t.Fatalf("run migrate: %v", err)
+		}
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q, got %q", want, out.String())
+		}
+	}
+
+	b, err := os.ReadFile(key)
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	if !bytes.HasPrefix(b, []byte(`{"version":1,`)) {
+		t.Errorf("unexpected history %s", b)
+	}
+	all, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(all) != 1 || all[0].Hash != "aaaaaaa" || all[0].DurationAVG != 10 {
+		t.Fatalf("unexpected history %+v", all)
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	in := t.TempDir()
+	good := writeFile(t, in, "good.json", cdpResult(10))
+	bad := writeFile(t, in, "bad.json", []byte(`{"duration_total":"100","duration_avg":10.5,"mem_peak":42}`))
+
+	var out bytes.Buffer
+	err := run(context.Background(), []string{"perf-fmt", "validate", "cdp", good, bad}, noEnv, nil, &out, io.Discard)
+	if !errors.Is(err, errInvalid) {
+		t.Fatalf("expected invalid error, got %v", err)
+	}
+	for _, want := range []string{
+		good + ": ok",
+		bad + ": $.duration_avg: expected integer, got number",
+		bad + ": $.duration_total: expected integer, got string",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in %q", want, out.String())
+		}
+	}
+	// the missing properties are accepted, like the append does.
+	if strings.Contains(out.String(), "cg_mem_peak") {
+		t.Errorf("unexpected missing property error in %q", out.String())
+	}
+
+	// the append stores the schemas next to the history.
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "cdp", "aaaaaaa", good}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run append: %v", err)
+	}
+	for _, file := range []string{inputSchemaFile, historySchemaFile} {
+		b, err := os.ReadFile(filepath.Join(dir, "cdp", file))
+		if err != nil {
+			t.Fatalf("read schema: %v", err)
+		}
+		if !strings.Contains(string(b), `"$schema"`) {
+			t.Errorf("unexpected %s %s", file, b)
+		}
+	}
+
+	// the unchanged schemas aren't pushed again.
+	out.Reset()
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "append", "--dry-run", "cdp", "bbbbbbb", good}, noEnv, nil, &out, io.Discard); err != nil {
+		t.Fatalf("run append dry run: %v", err)
+	}
+	if !strings.Contains(out.String(), "would push cdp/history.json") || strings.Contains(out.String(), "schema.json") {
+		t.Errorf("unexpected dry run output %q", out.String())
+	}
+
+	out.Reset()
+	if err := run(context.Background(), []string{"perf-fmt", "validate", "--history", "cdp", filepath.Join(dir, "cdp", "history.json")}, noEnv, nil, &out, io.Discard); err != nil {
+		t.Fatalf("run validate history: %v: %s", err, out.String())
+	}
+
+	out.Reset()
+	if err := run(context.Background(), []string{"perf-fmt", "schema", "wpt"}, noEnv, nil, &out, io.Discard); err != nil {
+		t.Fatalf("run schema: %v", err)
+	}
+	if !strings.Contains(out.String(), `"title": "wpt result"`) {
+		t.Errorf("unexpected schema %s", out.String())
+	}
+}
+
+func TestRunBranch(t *testing.T) {
+	dir, storeURL := newFileStore(t)
+
+	in := t.TempDir()
+	write := func(avg int) string {
+		return writeFile(t, in, strconv.Itoa(avg)+".json", cdpResult(avg))
+	}
+
+	env := map[string]string{"GITHUB_REF": "refs/heads/main"}
+	runArgs := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := run(context.Background(), append([]string{"perf-fmt", "--store", storeURL}, args...), func(k string) string { return env[k] }, nil, &out, io.Discard)
+		return out.String(), err
+	}
+
+	for _, hash := range []string{"aaaaaaa", "bbbbbbb"} {
+		if _, err := runArgs("cdp", hash, write(10)); err != nil {
+			t.Fatalf("run %s: %v", hash, err)
+		}
+	}
+
+	// a PR job writes and reads the PR's branch history.
+	env["GITHUB_HEAD_REF"] = "feature/x"
+	env["GITHUB_REF"] = "refs/pull/3/merge"
+	for hash, avg := range map[string]int{"ccccccc": 10, "ddddddd": 100} {
+		if _, err := runArgs("cdp", hash, write(avg)); err != nil {
+			t.Fatalf("run %s: %v", hash, err)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "cdp", "branches", "feature~2Fx", "history.json"))
+	if err != nil {
+		t.Fatalf("read branch history: %v", err)
+	}
+	branch, err := history.Decode[*cdp.OutResult](bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode branch history: %v", err)
+	}
+	if len(branch) != 2 || branch[0].Branch != "feature/x" || branch[0].PR != 3 {
+		t.Fatalf("unexpected branch history %+v", branch)
+	}
+
+	// the branch commits are checked against the main baseline.
+	if out, err := runArgs("check", "cdp", "ccccccc"); err != nil {
+		t.Errorf("check ccccccc: %v: %s", err, out)
+	}
+	if out, err := runArgs("check", "cdp", "ddddddd"); !errors.Is(err, errRegression) {
+		t.Errorf("expected a regression of ddddddd, got %v: %s", err, out)
+	}
+
+	out, err := runArgs("summary", "ccccccc")
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if !strings.Contains(out, "Compared to bbbbbbb.") {
+		t.Errorf("expected a comparison with the main branch, got %s", out)
+	}
+
+	// the option overrides the env branch.
+	if _, err := runArgs("--branch", "main", "check", "cdp", "ccccccc"); err == nil {
+		t.Errorf("expected ccccccc to be missing in the main history")
+	}
+}
+
+func TestBranchDir(t *testing.T) {
+	for branch, dir := range map[string]string{
+		"main":        "main",
+		"feature-x":   "feature-x",
+		"feature/x":   "feature~2Fx",
+		"feature~2Fx": "feature~7E2Fx",
+	} {
+		if got := branchDir(branch); got != dir {
+			t.Errorf("%s: expected %s, got %s", branch, dir, got)
+		}
+	}
+}
+
+func TestRunGlobalFlags(t *testing.T) {
+	// the append options aren't global options.
+	err := run(context.Background(), []string{"perf-fmt", "--store", "mem://", "--pr", "3", "check", "cdp", "aaaaaaa"}, noEnv, nil, io.Discard, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "not accepted before the check command") {
+		t.Errorf("expected an append option error, got %v", err)
+	}
+
+	// the help is printed once.
+	var stderr bytes.Buffer
+	if err := run(context.Background(), []string{"perf-fmt", "-h"}, noEnv, nil, io.Discard, &stderr); err != nil {
+		t.Errorf("run help: %v", err)
+	}
+	if n := strings.Count(stderr.String(), "usage:"); n != 1 {
+		t.Errorf("expected the usage once, got %d times", n)
+	}
+}
+
+func TestRunCommands(t *testing.T) {
+	_, storeURL := newFileStore(t)
+
+	in := writeResult(t)
+
+	// legacy form and append command.
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "--pr", "12", "cdp", "aaaaaaa", in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run legacy append: %v", err)
+	}
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "append", "--pr", "13", "cdp", "bbbbbbb", in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run append: %v", err)
+	}
+
+	// dry run doesn't push.
+	var out bytes.Buffer
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "append", "--dry-run", "cdp", "ccccccc", in}, noEnv, nil, &out, io.Discard); err != nil {
+		t.Fatalf("run dry run append: %v", err)
+	}
+	if !strings.Contains(out.String(), "added ccccccc") || !strings.Contains(out.String(), "would push cdp/history.json") {
+		t.Errorf("unexpected dry run output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := run(context.Background(), []string{"perf-fmt", "--store", storeURL, "export", "--format", "csv", "cdp"}, noEnv, nil, &out, io.Discard); err != nil {
+		t.Fatalf("run export: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected export:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[0], "commit,datetime,commit_datetime,branch,duration_total,duration_avg") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[2], "bbbbbbb,") {
+		t.Errorf("unexpected line %q", lines[2])
+	}
+
+	st, err := store.Open(storeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(serveHandler(st, options{mainBranch: "main"}, io.Discard))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/cdp/compare?a=aaaaaaa&b=bbbbbbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+
+	var c struct {
+		A string `json:"a"`
+		B string `json:"b"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&c); err != nil {
+		t.Fatalf("decode comparison: %v", err)
+	}
+	if c.A != "aaaaaaa" || c.B != "bbbbbbb" {
+		t.Errorf("unexpected comparison %+v", c)
+	}
+
+	res, err = http.Get(srv.URL + "/unknown/history.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected status %d for an unknown source", res.StatusCode)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	dir, _ := newFileStore(t)
+
+	cfg := filepath.Join(t.TempDir(), "perf-fmt.json")
+	if err := os.WriteFile(cfg, []byte(`{
+		"store": "file://`+dir+`",
+		"prefix": "staging",
+		"sources": {
+			"cdp": {"path": "browser/cdp"},
+			"startup": {"metrics": [{"name": "mean", "expr": "results[0].mean", "unit": "s"}]}
+		}
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	in := writeResult(t)
+
+	if err := run(context.Background(), []string{"perf-fmt", "--config", cfg, "append", "cdp", "aaaaaaa", in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run append: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "staging", "browser", "cdp", "history.json")); err != nil {
+		t.Errorf("history not stored in the configured path: %v", err)
+	}
+
+	// the option overrides the configured prefix.
+	if err := run(context.Background(), []string{"perf-fmt", "--config", cfg, "--prefix", "prod", "append", "cdp", "aaaaaaa", in}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run append: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "prod", "browser", "cdp", "history.json")); err != nil {
+		t.Errorf("history not stored in the prefix option path: %v", err)
+	}
+
+	// custom source declared in the config.
+	custom := filepath.Join(t.TempDir(), "startup.json")
+	if err := os.WriteFile(custom, []byte(`{"results":[{"mean":0.25}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(context.Background(), []string{"perf-fmt", "--config", cfg, "startup", "aaaaaaa", custom}, noEnv, nil, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run custom append: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "staging", "startup", "history.json"))
+	if err != nil {
+		t.Fatalf("read custom history: %v", err)
+	}
+	if !strings.Contains(string(b), `"values":{"mean":0.25}`) {
+		t.Errorf("unexpected custom history %s", b)
+	}
+}
+
+func TestAppendHistoryConflict(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+
+	// simulate another job pushing its result between our pull and push.
+	concurrent := 0
+	srv.BeforePut = func(key string) {
+		if key != "cdp/history.json" || concurrent > 0 {
+			return
+		}
+		concurrent++
+		srv.Set("bucket", key, []byte(`[{"commit":"ccccccc","datetime":"2024-01-01T00:00:00Z"}]`))
+	}
+
+	item := store.NewS3Store(srv.Session(), "bucket", "").Item("cdp/history.json", "application/json")
+	one := cdpResult(10)
+
+	e := history.Entry{Hash: "aaaaaaa", Time: time.Now().UTC()}
+	_, err := appendHistory(context.Background(), item, &cdp.Append{}, nil, history.PolicyFail, e, [][]byte{one})
+	if err != nil {
+		t.Fatalf("append history: %v", err)
+	}
+
+	r, err := item.Pull(context.Background())
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	defer r.Close()
+
+	all, err := history.Decode[*cdp.OutResult](r)
+	if err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+
+	// the concurrent result must not be lost.
+	if len(all) != 2 || all[0].Hash != "ccccccc" || all[1].Hash != "aaaaaaa" {
+		t.Fatalf("unexpected history: %+v", all)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/sources"
+)
+
+// errSkipPush cancels the push of a history up to date or dry run.
+var errSkipPush = errors.New("push skipped")
+
+// runMigrate upgrades the stored histories to the current version of the
+// sources' records.
+func runMigrate(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdMigrate, flag.ExitOnError)
+
+	dryRun := flags.Bool("dry-run", false, "print the migrations without pushing")
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [migrate options] [<source>...]\n", exec, CmdMigrate)
+		fmt.Fprintf(stderr, "\nUpgrade the sources' histories, or the --branch ones, in place with the\n")
+		fmt.Fprintf(stderr, "sources' registered migration steps. The legacy JSON arrays are converted\n")
+		fmt.Fprintf(stderr, "into versioned histories. All the registered sources are migrated by default.\n")
+		fmt.Fprintf(stderr, "\nThe migrate options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	names := flags.Args()
+	if len(names) == 0 {
+		for _, info := range sources.All() {
+			names = append(names, info.Name)
+		}
+	}
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		src, path, err := opts.lookupSource(name, history.PolicyFail)
+		if err != nil {
+			flags.Usage()
+			return err
+		}
+
+		// the custom sources have no migration steps.
+		var steps []history.Migration
+		if info, err := sources.Lookup(name); err == nil {
+			steps = info.Migrations
+		}
+
+		path = opts.branchPath(path, opts.branch)
+		key := path + "/history.json"
+
+		var (
+			from, to int
+			changed  bool
+		)
+		err = updateItem(ctx, st.Item(key, "application/json"), func(cur []byte) ([]byte, error) {
+			changed = false
+			if len(bytes.TrimSpace(cur)) == 0 {
+				return nil, errSkipPush
+			}
+
+			var (
+				buf bytes.Buffer
+				err error
+			)
+			if from, to, err = history.Migrate(&buf, bytes.NewReader(cur), steps); err != nil {
+				return nil, fmt.Errorf("migrate %s: %w", key, err)
+			}
+
+			// the migrated history is checked and normalized by the source.
+			records, err := src.Decode(&buf)
+			if err != nil {
+				return nil, fmt.Errorf("decode migrated %s: %w", key, err)
+			}
+			buf.Reset()
+			if err := history.Encode(&buf, records); err != nil {
+				return nil, err
+			}
+
+			if bytes.Equal(buf.Bytes(), cur) {
+				return nil, errSkipPush
+			}
+			changed = true
+			if *dryRun {
+				return nil, errSkipPush
+			}
+
+			return buf.Bytes(), nil
+		})
+		switch {
+		case errors.Is(err, errSkipPush) && !changed:
+			fmt.Fprintf(stdout, "%s is up to date\n", key)
+			continue
+		case errors.Is(err, errSkipPush):
+			fmt.Fprintf(stdout, "would migrate %s from version %d to %d\n", key, from, to)
+			continue
+		case err != nil:
+			return err
+		}
+		fmt.Fprintf(stdout, "%s migrated from version %d to %d\n", key, from, to)
+
+		// the history schema follows the version.
+		info, err := opts.lookupInfo(name)
+		if err != nil {
+			return err
+		}
+		if err := pushSchemas(ctx, st, path, info); err != nil {
+			return err
+		}
+
+		if err := invalidate(ctx, st, opts, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
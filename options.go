@@ -0,0 +1,271 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/config"
+	"github.com/lightpanda-io/perf-fmt/custom"
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/sources"
+	"github.com/lightpanda-io/perf-fmt/store"
+)
+
+// options contains the global options shared by the commands.
+type options struct {
+	dev bool
+	url string
+	// repo is the optional local git repository used to resolve commits.
+	repo string
+	// branch is the resolved branch, it selects the history written and
+	// read by the commands. The main branch history is used if empty.
+	branch     string
+	mainBranch string
+	// strictEnv refuses comparisons of different runner environments.
+	strictEnv bool
+	// prefix is prepended to the sources' paths.
+	prefix string
+	cfg    config.Config
+	// append contains the append options given before the legacy append
+	// form.
+	append *appendOptions
+	// getenv reads the CI env vars.
+	getenv func(string) string
+}
+
+// checkEnv returns an error if the environments differ in strict mode.
+func (o options) checkEnv(diff []string) error {
+	if o.strictEnv && len(diff) > 0 {
+		return fmt.Errorf("%w: %s", errEnvMismatch, strings.Join(diff, ", "))
+	}
+	return nil
+}
+
+// open returns the store.
+// The store is the --store one, then the s3://$AWS_BUCKET one, then the
+// configured one. The default store is the s3://lpd-perf one.
+func (o options) open() (store.Store, error) {
+	// prepare S3 connection
+	// set default env region if not already set.
+	if _, ok := os.LookupEnv("AWS_REGION"); !ok {
+		region := o.cfg.Region
+		if region == "" {
+			region = AWSRegion
+		}
+		os.Setenv("AWS_REGION", region)
+	}
+
+	url := o.url
+	if url == "" {
+		if bucket, ok := os.LookupEnv("AWS_BUCKET"); ok {
+			url = "s3://" + bucket
+		} else if o.cfg.Store != "" {
+			url = o.cfg.Store
+		} else {
+			url = "s3://" + AWSBucket
+		}
+	}
+
+	st, err := store.Open(url)
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+
+	return st, nil
+}
+
+// path returns the source's path, in the `dev/` dir if dev is enabled.
+func (o options) path(path string) string {
+	if o.prefix != "" {
+		path = o.prefix + "/" + path
+	}
+	if o.dev {
+		return "dev/" + path
+	}
+	return path
+}
+
+// lookupSource returns the source and its storage path, the configured
+// path takes precedence over the default one.
+// Custom sources declared in the configuration are stored in their name's
+// path by default.
+func (o options) lookupSource(name string, policy history.Policy) (Source, string, error) {
+	cfg := o.cfg.Source(name)
+
+	var (
+		src  Source
+		path string
+	)
+	info, err := sources.Lookup(name)
+	switch {
+	case err == nil:
+		src, path = info.New(policy), info.Path
+	case errors.Is(err, sources.ErrUnknown) && len(cfg.Metrics) > 0:
+		path = name
+		if src, err = custom.NewAppend(cfg.Metrics, policy); err != nil {
+			return nil, "", fmt.Errorf("source %s: %w", name, err)
+		}
+	default:
+		return nil, "", err
+	}
+
+	if cfg.Path != "" {
+		path = cfg.Path
+	}
+
+	return src, path, nil
+}
+
+// customSources returns the sorted names of the custom sources.
+func (o options) customSources() []string {
+	var names []string
+	for name, cfg := range o.cfg.Sources {
+		if len(cfg.Metrics) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// checkConfig validates the configured sources.
+func (o options) checkConfig() error {
+	for name, cfg := range o.cfg.Sources {
+		if _, err := sources.Lookup(name); err == nil && len(cfg.Metrics) > 0 {
+			return fmt.Errorf("config: builtin source %s can't declare metrics", name)
+		}
+		if _, _, err := o.lookupSource(name, history.PolicyFail); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// cdnDistribution returns the CloudFront distribution to invalidate, the
+// AWS_CF_DISTRIBUTION env var takes precedence over the configured one.
+func (o options) cdnDistribution() string {
+	if did := o.getenv("AWS_CF_DISTRIBUTION"); did != "" {
+		return did
+	}
+	return o.cfg.CDN.CloudFrontDistribution
+}
+
+// isMain returns true if the branch uses the main history.
+func (o options) isMain(branch string) bool {
+	return branch == "" || branch == o.mainBranch
+}
+
+// branchPath returns the source's path for the branch.
+// The main branch history is stored in the source's path, the other
+// branches' histories are stored in the branches/<branch> sub dir.
+func (o options) branchPath(path, branch string) string {
+	path = o.path(path)
+	if o.isMain(branch) {
+		return path
+	}
+
+	return path + "/branches/" + branchDir(branch)
+}
+
+// branchDir returns the branch name usable as a single storage dir name.
+// The bytes other than letters, digits, '-', '_' and '.' are escaped as ~XX
+// so distinct branches have distinct dirs, e.g. feature/x is feature~2Fx.
+func branchDir(branch string) string {
+	var b strings.Builder
+	for _, c := range []byte(branch) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "~%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// resolveBranch returns the branch of the results and of the histories read
+// by the commands: the --branch option, then the GitHub Actions env vars,
+// then the current branch of the repository.
+func resolveBranch(ctx context.Context, branch, repo string, getenv func(string) string) (string, error) {
+	if branch != "" {
+		return branch, nil
+	}
+	if branch = git.BranchFromEnv(getenv); branch != "" {
+		return branch, nil
+	}
+	if repo == "" {
+		return "", nil
+	}
+
+	branch, err := git.Repo{Dir: repo}.Branch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("read current branch: %w", err)
+	}
+
+	return branch, nil
+}
+
+// commit validates the commit hash.
+// If a repository is set, the commit can also be a ref which is resolved to
+// its full hash.
+func (o options) commit(ctx context.Context, s string) (git.CommitHash, error) {
+	if o.repo == "" {
+		return git.ParseCommitHash(s)
+	}
+
+	return git.Repo{Dir: o.repo}.Resolve(ctx, s)
+}
+
+// entry returns the history entry of the commit ingested at now.
+// If a repository is set, the entry contains the commit's parents, dates and
+// metadata.
+func (o options) entry(ctx context.Context, s string, now time.Time) (history.Entry, error) {
+	hash, err := o.commit(ctx, s)
+	if err != nil {
+		return history.Entry{}, err
+	}
+
+	e := history.Entry{Hash: hash, Time: now}
+	if o.repo == "" {
+		return e, nil
+	}
+
+	c, err := git.Repo{Dir: o.repo}.Commit(ctx, string(hash))
+	if err != nil {
+		return history.Entry{}, fmt.Errorf("read commit: %w", err)
+	}
+
+	e.Parents = c.Parents
+	e.AuthorTime = c.AuthorTime
+	e.CommitTime = c.CommitTime
+
+	if e.Metadata, err = (git.Repo{Dir: o.repo}).Metadata(ctx, hash); err != nil {
+		return history.Entry{}, fmt.Errorf("read commit metadata: %w", err)
+	}
+
+	return e, nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/audit"
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/s3"
+)
+
+// runRebuild rebuilds the source's history from the single results stored
+// next to it.
+func runRebuild(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdRebuild, flag.ExitOnError)
+
+	dryRun := flags.Bool("dry-run", false, "print the history changes without pushing")
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [rebuild options] <source>\n", exec, CmdRebuild)
+		fmt.Fprintf(stderr, "\nRebuild the source's history, or the --branch one, from the single results\n")
+		fmt.Fprintf(stderr, "<date>_<time>_<hash>.json stored next to it.\n")
+		fmt.Fprintf(stderr, "A later first run of a commit replaces its record, the next runs are merged.\n")
+		fmt.Fprintf(stderr, "The commits' metadata and times are kept from the current history if it's readable,\n")
+		fmt.Fprintf(stderr, "or read from the --repo repository.\n")
+		fmt.Fprintf(stderr, "The results of the commits deleted since they were stored are skipped.\n")
+		fmt.Fprintf(stderr, "\nThe rebuild options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	// a later result of a commit replaces the previous one.
+	src, path, err := opts.lookupSource(args[0], history.PolicyReplace)
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+	runs, _, err := opts.lookupSource(args[0], history.PolicyAppendRun)
+	if err != nil {
+		return err
+	}
+
+	path = opts.branchPath(path, opts.branch)
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+	item := st.Item(path+"/history.json", "application/json")
+
+	r, version, err := item.PullVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("pull all files: %w", err)
+	}
+	cur, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("read all files: %w", err)
+	}
+
+	// the current history gives the commits' metadata lost in the single
+	// results.
+	old, err := src.Decode(bytes.NewReader(cur))
+	if err != nil {
+		fmt.Fprintf(stderr, "warning: current history ignored: %v\n", err)
+		old = nil
+	}
+	metas := make(map[git.CommitHash]*history.Entry, len(old))
+	for _, v := range old {
+		metas[v.Meta().Hash] = v.Meta()
+	}
+
+	// the results of the deleted commits are skipped.
+	log, err := pull(ctx, st.Item(path+"/"+auditLog, "application/x-ndjson"))
+	if err != nil {
+		return err
+	}
+	events, err := audit.Decode(bytes.NewReader(log))
+	if err != nil {
+		return err
+	}
+	deleted := audit.Deleted(events)
+
+	keys, err := st.List(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		key  string
+		name history.ResultName
+	}
+	var results []result
+	for _, key := range keys {
+		base := key[strings.LastIndex(key, "/")+1:]
+		if base == "history.json" || base == auditLog || base == inputSchemaFile || base == historySchemaFile {
+			continue
+		}
+
+		name, err := history.ParseResultName(base)
+		if err != nil {
+			fmt.Fprintf(stderr, "warning: %s ignored: %v\n", key, err)
+			continue
+		}
+		if deletedResult(name, deleted, metas) {
+			continue
+		}
+		results = append(results, result{key: key, name: name})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].name.Before(results[j].name)
+	})
+
+	var all []byte
+	for _, res := range results {
+		e, err := rebuildEntry(ctx, opts, metas, res.name)
+		if err != nil {
+			return err
+		}
+
+		one, err := pull(ctx, st.Item(res.key, "application/json"))
+		if err != nil {
+			return err
+		}
+
+		app := src
+		if res.name.Run > 1 {
+			app = runs
+		}
+
+		var buf bytes.Buffer
+		if err := app.Append(ctx, e, &buf, bytes.NewReader(all), bytes.NewReader(one)); err != nil {
+			return fmt.Errorf("append %s: %w", res.key, err)
+		}
+		all = buf.Bytes()
+	}
+
+	if *dryRun {
+		fmt.Fprintf(stdout, "dry run, nothing is pushed.\n\n%s/history.json changes:\n", path)
+
+		new, err := src.Decode(bytes.NewReader(all))
+		if err != nil {
+			return fmt.Errorf("decode new history: %w", err)
+		}
+		changes, err := history.Diff(old, new)
+		if err != nil {
+			return err
+		}
+		if err := history.WriteDiff(stdout, changes); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "\nwould push %s/history.json\n", path)
+		return nil
+	}
+
+	if err := item.PushVersion(ctx, bytes.NewReader(all), version); err != nil {
+		return fmt.Errorf("push history: %w", err)
+	}
+	fmt.Fprintf(stdout, "%s/history.json rebuilt from %d results\n", path, len(results))
+
+	return invalidate(ctx, st, opts, path)
+}
+
+// deletedResult returns true if the single result was stored before its
+// commit's deletion.
+// The result names' time is truncated to the minute: a result of the
+// deletion's minute is kept only if the current history has the commit added
+// again after the deletion, with at least the result's run.
+func deletedResult(name history.ResultName, deleted map[git.CommitHash]time.Time, metas map[git.CommitHash]*history.Entry) bool {
+	t, ok := deleted[name.Hash]
+	switch {
+	case !ok || name.Time.After(t):
+		return false
+	case name.Time.Before(t.Truncate(time.Minute)):
+		return true
+	}
+
+	m, ok := metas[name.Hash]
+	return !ok || m.Time.Before(t) || name.Run > max(m.Runs, 1)
+}
+
+// rebuildEntry returns the history entry of the single result name.
+// The metadata and the time are copied from the metas entries, or read
+// from the repository.
+func rebuildEntry(ctx context.Context, opts options, metas map[git.CommitHash]*history.Entry, name history.ResultName) (history.Entry, error) {
+	e := history.Entry{Hash: name.Hash, Time: name.Time}
+
+	if m, ok := metas[name.Hash]; ok {
+		e.Time = m.Time
+		e.Parents = m.Parents
+		e.AuthorTime = m.AuthorTime
+		e.CommitTime = m.CommitTime
+		e.Metadata = m.Metadata
+		e.Env = m.Env
+		e.Quarantine = m.Quarantine
+		return e, nil
+	}
+
+	if opts.repo != "" {
+		re, err := opts.entry(ctx, string(name.Hash), name.Time)
+		if err != nil {
+			return history.Entry{}, err
+		}
+		e = re
+	}
+	if !opts.isMain(opts.branch) && e.Branch == "" {
+		e.Branch = opts.branch
+	}
+
+	return e, nil
+}
+
+// pull reads the whole item.
+func pull(ctx context.Context, item s3.Puller) ([]byte, error) {
+	r, err := item.Pull(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pull: %w", err)
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package regression compares a history record with a baseline built from
+// the previous records.
+package regression
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/runner"
+	"github.com/lightpanda-io/perf-fmt/stats"
+)
+
+// ErrNotFound is the history's error of a commit without record.
+var ErrNotFound = history.ErrNotFound
+
+const (
+	DefaultBaseline  = 5
+	DefaultThreshold = 10.0
+)
+
+// Config configures the check.
+type Config struct {
+	// Baseline is the number of previous records used as baseline.
+	Baseline int
+	// Threshold is the maximum relative degradation in percent.
+	Threshold float64
+	// Thresholds overrides the threshold per metric name.
+	Thresholds map[string]float64
+}
+
+func (c Config) threshold(metric string) float64 {
+	if t, ok := c.Thresholds[metric]; ok {
+		return t
+	}
+	return c.Threshold
+}
+
+// Result is the comparison of one metric.
+type Result struct {
+	Metric    string
+	Value     float64
+	Baseline  float64
+	Threshold float64
+	// Change is the relative change in percent, positive when the metric
+	// got worse.
+	Change    float64
+	Regressed bool
+}
+
+type Report struct {
+	Hash git.CommitHash
+	// Baseline contains the hashes of the baseline records.
+	Baseline []git.CommitHash
+	Results  []Result
+	// EnvDiff lists the differences between the runner environment of the
+	// record and the baseline ones.
+	EnvDiff []string
+}
+
+// Regressed returns true if at least one metric regressed.
+func (r Report) Regressed() bool {
+	for _, v := range r.Results {
+		if v.Regressed {
+			return true
+		}
+	}
+	return false
+}
+
+// Check compares the hash's record with the median of the previous records.
+// The records must be ordered.
+func Check(records []history.Record, hash git.CommitHash, cfg Config) (Report, error) {
+	if cfg.Baseline <= 0 {
+		cfg.Baseline = DefaultBaseline
+	}
+
+	idx, err := history.Index(records, hash)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Hash: hash}
+
+	// quarantined records are excluded from the baseline.
+	var baseline []history.Record
+	for i := idx - 1; i >= 0 && len(baseline) < cfg.Baseline; i-- {
+		if !history.Quarantined(records[i]) {
+			baseline = append(baseline, records[i])
+		}
+	}
+	slices.Reverse(baseline)
+	if len(baseline) == 0 {
+		return report, nil
+	}
+
+	env := records[idx].Meta().Env
+	seen := make(map[string]bool)
+	samples := make(map[string][]float64)
+	for _, v := range baseline {
+		report.Baseline = append(report.Baseline, v.Meta().Hash)
+		for _, d := range runner.Diff(v.Meta().Env, env) {
+			if !seen[d] {
+				seen[d] = true
+				report.EnvDiff = append(report.EnvDiff, d)
+			}
+		}
+		for _, m := range history.Values(v) {
+			samples[m.Name] = append(samples[m.Name], m.Value)
+		}
+	}
+
+	for _, m := range history.Values(records[idx]) {
+		base, ok := samples[m.Name]
+		if !ok {
+			continue
+		}
+
+		res := Result{
+			Metric:    m.Name,
+			Value:     m.Value,
+			Baseline:  stats.Median(base),
+			Threshold: cfg.threshold(m.Name),
+		}
+		res.Change = change(res.Value, res.Baseline, m.HigherIsBetter)
+		res.Regressed = res.Change > res.Threshold
+
+		report.Results = append(report.Results, res)
+	}
+
+	return report, nil
+}
+
+// change returns the relative change in percent, positive when the value is
+// worse than the baseline.
+func change(value, baseline float64, higherIsBetter bool) float64 {
+	diff := value - baseline
+	if higherIsBetter {
+		diff = -diff
+	}
+
+	if diff == 0 {
+		return 0
+	}
+	if baseline == 0 {
+		return math.Copysign(math.Inf(1), diff)
+	}
+
+	return diff / math.Abs(baseline) * 100
+}
+
+// Write writes a readable report.
+func (r Report) Write(w io.Writer) error {
+	if len(r.Baseline) == 0 {
+		_, err := fmt.Fprintf(w, "%s: no baseline, nothing to compare\n", r.Hash)
+		return err
+	}
+
+	fmt.Fprintf(w, "%s compared to the median of %d previous commits (%s..%s)\n\n",
+		r.Hash, len(r.Baseline), r.Baseline[0], r.Baseline[len(r.Baseline)-1])
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "metric\tvalue\tbaseline\tchange\tthreshold\tstatus")
+	for _, v := range r.Results {
+		status := "ok"
+		if v.Regressed {
+			status = "REGRESSION"
+		}
+		fmt.Fprintf(tw, "%s\t%g\t%g\t%+.2f%%\t%.2f%%\t%s\n",
+			v.Metric, v.Value, v.Baseline, v.Change, v.Threshold, status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, d := range r.EnvDiff {
+		fmt.Fprintf(w, "warning: environment differs: %s\n", d)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regression
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/history/historytest"
+)
+
+func records(values ...[2]float64) []history.Record {
+	var res []history.Record
+	for i, v := range values {
+		res = append(res, historytest.New(git.CommitHash(string(rune('a'+i))),
+			history.Metric{Name: "duration", Value: v[0]},
+			history.Metric{Name: "pass", Value: v[1], HigherIsBetter: true},
+		))
+	}
+	return res
+}
+
+func TestCheck(t *testing.T) {
+	all := records([2]float64{100, 10}, [2]float64{110, 10}, [2]float64{90, 10}, [2]float64{115, 8})
+
+	report, err := Check(all, "d", Config{Baseline: 3, Threshold: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(report.Baseline) != 3 || len(report.Results) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	duration := report.Results[0]
+	if duration.Baseline != 100 || duration.Change != 15 || !duration.Regressed {
+		t.Errorf("unexpected duration result: %+v", duration)
+	}
+
+	// pass is higher is better: 10 -> 8 is a 20% degradation.
+	pass := report.Results[1]
+	if pass.Change != 20 || !pass.Regressed {
+		t.Errorf("unexpected pass result: %+v", pass)
+	}
+
+	report, err = Check(all, "d", Config{Baseline: 3, Threshold: 10, Thresholds: map[string]float64{"duration": 20, "pass": 25}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Regressed() {
+		t.Errorf("unexpected regression: %+v", report)
+	}
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	t.Log(buf.String())
+}
+
+func TestCheckNoBaseline(t *testing.T) {
+	all := records([2]float64{100, 10})
+
+	report, err := Check(all, "a", Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Regressed() || len(report.Results) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	if _, err := Check(all, "z", Config{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestCheckQuarantine(t *testing.T) {
+	all := records([2]float64{100, 10}, [2]float64{200, 10}, [2]float64{100, 10}, [2]float64{105, 10})
+	all[1].Meta().Quarantine = &history.Quarantine{Reason: "noisy runner"}
+
+	report, err := Check(all, "d", Config{Baseline: 2, Threshold: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the quarantined record is skipped, the baseline is a and c.
+	if len(report.Baseline) != 2 || report.Baseline[0] != "a" || report.Baseline[1] != "c" {
+		t.Fatalf("unexpected baseline: %v", report.Baseline)
+	}
+	if report.Results[0].Baseline != 100 {
+		t.Errorf("unexpected duration baseline: %+v", report.Results[0])
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runner describes the machine running the benchmarks.
+// Results from different environments are not comparable.
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Env is the fingerprint of a runner environment.
+// The fields are optional, unknown values are empty.
+type Env struct {
+	CPU   string `json:"cpu,omitempty"`
+	Cores int    `json:"cores,omitempty"`
+	// Memory is the total memory in bytes.
+	Memory uint64 `json:"memory,omitempty"`
+	Kernel string `json:"kernel,omitempty"`
+	OS     string `json:"os,omitempty"`
+	Arch   string `json:"arch,omitempty"`
+	// Runner is the runner label, e.g. the CI machine type.
+	Runner string `json:"runner,omitempty"`
+	// Zig and V8 versions are given by the user.
+	Zig string `json:"zig,omitempty"`
+	V8  string `json:"v8,omitempty"`
+}
+
+// Gather reads the environment of the current machine.
+func Gather() Env {
+	return GatherFS(os.DirFS("/"))
+}
+
+// GatherFS reads the environment from the /proc and /etc files of the root
+// file system. Missing files are ignored.
+func GatherFS(root fs.FS) Env {
+	e := Env{
+		Cores: runtime.NumCPU(),
+		Arch:  runtime.GOARCH,
+		OS:    runtime.GOOS,
+	}
+
+	if b, err := fs.ReadFile(root, "proc/cpuinfo"); err == nil {
+		e.CPU = field(b, "model name", ':')
+	}
+
+	if b, err := fs.ReadFile(root, "proc/meminfo"); err == nil {
+		// MemTotal:       16318848 kB
+		v, _, _ := strings.Cut(field(b, "MemTotal", ':'), " ")
+		if kb, err := strconv.ParseUint(v, 10, 64); err == nil {
+			e.Memory = kb * 1024
+		}
+	}
+
+	if b, err := fs.ReadFile(root, "proc/sys/kernel/osrelease"); err == nil {
+		e.Kernel = strings.TrimSpace(string(b))
+	}
+
+	if b, err := fs.ReadFile(root, "etc/os-release"); err == nil {
+		if name := strings.Trim(field(b, "PRETTY_NAME", '='), `"`); name != "" {
+			e.OS = name
+		}
+	}
+
+	return e
+}
+
+// field returns the first value of the key in a key/value file.
+func field(b []byte, key string, sep byte) string {
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), string(sep))
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// Diff returns a description of the differences between the environments.
+// It returns nil if an environment is unknown.
+func Diff(a, b *Env) []string {
+	if a == nil || b == nil {
+		return nil
+	}
+
+	var diff []string
+	cmp := func(name, va, vb string) {
+		if va != vb {
+			diff = append(diff, fmt.Sprintf("%s: %q != %q", name, va, vb))
+		}
+	}
+
+	cmp("cpu", a.CPU, b.CPU)
+	cmp("cores", strconv.Itoa(a.Cores), strconv.Itoa(b.Cores))
+	// the total memory can vary slightly on the same machine type.
+	cmp("memory", gib(a.Memory), gib(b.Memory))
+	cmp("kernel", a.Kernel, b.Kernel)
+	cmp("os", a.OS, b.OS)
+	cmp("arch", a.Arch, b.Arch)
+	cmp("runner", a.Runner, b.Runner)
+	cmp("zig", a.Zig, b.Zig)
+	cmp("v8", a.V8, b.V8)
+
+	return diff
+}
+
+func gib(v uint64) string {
+	return fmt.Sprintf("%dGiB", (v+1<<29)>>30)
+}
@@ -0,0 +1,64 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestGatherFS(t *testing.T) {
+	root := fstest.MapFS{
+		"proc/cpuinfo":              {Data: []byte("processor\t: 0\nmodel name\t: AMD EPYC 7763 64-Core Processor\n\nprocessor\t: 1\nmodel name\t: AMD EPYC 7763 64-Core Processor\n")},
+		"proc/meminfo":              {Data: []byte("MemTotal:       16318848 kB\nMemFree:         1000000 kB\n")},
+		"proc/sys/kernel/osrelease": {Data: []byte("6.8.0-1021-azure\n")},
+		"etc/os-release":            {Data: []byte("NAME=\"Ubuntu\"\nPRETTY_NAME=\"Ubuntu 24.04.1 LTS\"\n")},
+	}
+
+	e := GatherFS(root)
+
+	if e.CPU != "AMD EPYC 7763 64-Core Processor" {
+		t.Errorf("unexpected cpu %q", e.CPU)
+	}
+	if e.Memory != 16318848*1024 {
+		t.Errorf("unexpected memory %d", e.Memory)
+	}
+	if e.Kernel != "6.8.0-1021-azure" {
+		t.Errorf("unexpected kernel %q", e.Kernel)
+	}
+	if e.OS != "Ubuntu 24.04.1 LTS" {
+		t.Errorf("unexpected os %q", e.OS)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := &Env{CPU: "cpu", Cores: 4, Memory: 16318848 * 1024, Runner: "ubuntu-latest"}
+	b := *a
+	b.Memory = 16318000 * 1024
+
+	if diff := Diff(a, &b); len(diff) != 0 {
+		t.Errorf("unexpected diff %v", diff)
+	}
+
+	b.Cores = 8
+	b.Runner = "self-hosted"
+	if diff := Diff(a, &b); len(diff) != 2 {
+		t.Errorf("unexpected diff %v", diff)
+	}
+
+	if diff := Diff(a, nil); diff != nil {
+		t.Errorf("unexpected diff with unknown env %v", diff)
+	}
+}
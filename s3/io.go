@@ -18,14 +18,19 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -39,6 +44,24 @@ type Pusher interface {
 	Push(ctx context.Context, r io.Reader) error
 }
 
+// ErrConflict is returned by a versioned push when the item has been modified
+// since it was pulled.
+var ErrConflict = errors.New("version conflict")
+
+// Version identifies an item content.
+// The empty version is used for a missing item.
+type Version string
+
+type VersionedPuller interface {
+	PullVersion(ctx context.Context) (io.ReadCloser, Version, error)
+}
+
+// VersionedPusher pushes the content only if the stored item's version is
+// still v, otherwise it returns ErrConflict.
+type VersionedPusher interface {
+	PushVersion(ctx context.Context, r io.Reader, v Version) error
+}
+
 type FileIO struct {
 	Path string
 }
@@ -57,18 +80,82 @@ func (fio *FileIO) Pull(ctx context.Context) (io.ReadCloser, error) {
 }
 
 func (fio *FileIO) Push(ctx context.Context, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(fio.Path), 0o755); err != nil {
+		return fmt.Errorf("create dir: %w", err)
+	}
+
 	f, err := os.Create(fio.Path)
 	if err != nil {
 		return fmt.Errorf("open file: %w", err)
 	}
 
 	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
 		return fmt.Errorf("write file: %w", err)
 	}
 
+	return f.Close()
+}
+
+func (fio *FileIO) PullVersion(ctx context.Context) (io.ReadCloser, Version, error) {
+	b, err := os.ReadFile(fio.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return io.NopCloser(&bytes.Buffer{}), "", nil
+		}
+
+		return nil, "", fmt.Errorf("read file: %w", err)
+	}
+
+	return io.NopCloser(bytes.NewReader(b)), fileVersion(b), nil
+}
+
+// LockSuffix is the suffix of the lock files of the versioned file pushes.
+const LockSuffix = ".lock"
+
+// PushVersion holds a lock file during the version check and the write, so
+// concurrent pushes from other processes fail with ErrConflict.
+func (fio *FileIO) PushVersion(ctx context.Context, r io.Reader, v Version) error {
+	if err := os.MkdirAll(filepath.Dir(fio.Path), 0o755); err != nil {
+		return fmt.Errorf("create dir: %w", err)
+	}
+
+	unlock, err := lockFile(fio.Path + LockSuffix)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	b, err := os.ReadFile(fio.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read file: %w", err)
+	}
+
+	var current Version
+	if err == nil {
+		current = fileVersion(b)
+	}
+	if current != v {
+		return ErrConflict
+	}
+
+	// write a temp file and rename it to replace the content atomically.
+	tmp := fio.Path + ".tmp"
+	if err := (&FileIO{Path: tmp}).Push(ctx, r); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, fio.Path); err != nil {
+		return fmt.Errorf("rename file: %w", err)
+	}
+
 	return nil
 }
 
+func fileVersion(b []byte) Version {
+	sum := sha256.Sum256(b)
+	return Version(hex.EncodeToString(sum[:]))
+}
+
 type S3IO struct {
 	svc         *s3.S3
 	uploader    *s3manager.Uploader
@@ -96,6 +183,12 @@ func NewS3IO(sess *session.Session, bucket, item, contentType string) *S3IO {
 }
 
 func (s3io *S3IO) Pull(ctx context.Context) (io.ReadCloser, error) {
+	r, _, err := s3io.PullVersion(ctx)
+	return r, err
+}
+
+// PullVersion returns the object's content and its ETag as version.
+func (s3io *S3IO) PullVersion(ctx context.Context) (io.ReadCloser, Version, error) {
 	obj, err := s3io.svc.GetObjectWithContext(ctx,
 		&s3.GetObjectInput{
 			Bucket: aws.String(s3io.bucket),
@@ -105,24 +198,26 @@ func (s3io *S3IO) Pull(ctx context.Context) (io.ReadCloser, error) {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case s3.ErrCodeNoSuchKey:
-				return io.NopCloser(&bytes.Buffer{}), nil
+				return io.NopCloser(&bytes.Buffer{}), "", nil
 			default:
-				return nil, fmt.Errorf("awserr: get object: %w", err)
+				return nil, "", fmt.Errorf("awserr: get object: %w", err)
 			}
 		}
-		return nil, fmt.Errorf("get object: %w", err)
+		return nil, "", fmt.Errorf("get object: %w", err)
 	}
 
+	version := Version(aws.StringValue(obj.ETag))
+
 	if aws.StringValue(obj.ContentEncoding) == "gzip" {
 		gr, err := gzip.NewReader(obj.Body)
 		if err != nil {
 			obj.Body.Close()
-			return nil, fmt.Errorf("gzip reader: %w", err)
+			return nil, "", fmt.Errorf("gzip reader: %w", err)
 		}
-		return &gzipReadCloser{gr: gr, body: obj.Body}, nil
+		return &gzipReadCloser{gr: gr, body: obj.Body}, version, nil
 	}
 
-	return obj.Body, nil
+	return obj.Body, version, nil
 }
 
 type gzipReadCloser struct {
@@ -163,3 +258,47 @@ func (s3io *S3IO) Push(ctx context.Context, r io.Reader) error {
 
 	return nil
 }
+
+// PushVersion uploads the object with a conditional put: If-Match with the
+// version's ETag, or If-None-Match if the object didn't exist.
+func (s3io *S3IO) PushVersion(ctx context.Context, r io.Reader, v Version) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := io.Copy(gz, r); err != nil {
+		return fmt.Errorf("gzip compress: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("gzip close: %w", err)
+	}
+
+	input := &s3.PutObjectInput{
+		ACL:             aws.String(s3io.acl),
+		Body:            bytes.NewReader(buf.Bytes()),
+		Bucket:          aws.String(s3io.bucket),
+		Key:             aws.String(s3io.item),
+		ContentEncoding: aws.String("gzip"),
+	}
+	if s3io.contentType != "" {
+		input.ContentType = aws.String(s3io.contentType)
+	}
+
+	// The SDK's PutObjectInput doesn't expose the conditional headers.
+	cond := map[string]string{"If-None-Match": "*"}
+	if v != "" {
+		cond = map[string]string{"If-Match": string(v)}
+	}
+
+	_, err := s3io.svc.PutObjectWithContext(ctx, input, request.WithSetRequestHeaders(cond))
+	if err != nil {
+		if rerr, ok := err.(awserr.RequestFailure); ok {
+			switch rerr.StatusCode() {
+			// S3 returns 409 when a concurrent conditional write is in progress.
+			case http.StatusPreconditionFailed, http.StatusConflict:
+				return ErrConflict
+			}
+		}
+		return fmt.Errorf("put object: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/s3"
+	"github.com/lightpanda-io/perf-fmt/s3/s3test"
+)
+
+type versionedIO interface {
+	s3.VersionedPuller
+	s3.VersionedPusher
+}
+
+func testVersionedIO(t *testing.T, vio versionedIO) {
+	ctx := context.Background()
+
+	pull := func() (string, s3.Version) {
+		t.Helper()
+		r, v, err := vio.PullVersion(ctx)
+		if err != nil {
+			t.Fatalf("pull: %v", err)
+		}
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return string(b), v
+	}
+
+	content, v0 := pull()
+	if content != "" || v0 != "" {
+		t.Fatalf("unexpected missing item: %q %q", content, v0)
+	}
+
+	if err := vio.PushVersion(ctx, strings.NewReader("one"), v0); err != nil {
+		t.Fatalf("push first: %v", err)
+	}
+
+	// the item exists now, pushing with the empty version conflicts.
+	if err := vio.PushVersion(ctx, strings.NewReader("two"), v0); !errors.Is(err, s3.ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+
+	content, v1 := pull()
+	if content != "one" || v1 == "" {
+		t.Fatalf("unexpected item: %q %q", content, v1)
+	}
+
+	if err := vio.PushVersion(ctx, strings.NewReader("two"), v1); err != nil {
+		t.Fatalf("push second: %v", err)
+	}
+
+	// v1 is outdated.
+	if err := vio.PushVersion(ctx, strings.NewReader("three"), v1); !errors.Is(err, s3.ErrConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+
+	if content, _ := pull(); content != "two" {
+		t.Fatalf("unexpected content %q", content)
+	}
+}
+
+func TestS3IOVersion(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+
+	testVersionedIO(t, s3.NewS3IO(srv.Session(), "bucket", "dir/history.json", "application/json"))
+}
+
+func TestFileIOVersion(t *testing.T) {
+	testVersionedIO(t, &s3.FileIO{Path: filepath.Join(t.TempDir(), "dir", "history.json")})
+}
+
+func TestFileIOStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+
+	// a crashed push leaves its lock file.
+	if err := os.WriteFile(path+s3.LockSuffix, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path+s3.LockSuffix, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	fio := &s3.FileIO{Path: path}
+	if err := fio.PushVersion(context.Background(), strings.NewReader("one"), ""); err != nil {
+		t.Fatalf("push with a stale lock: %v", err)
+	}
+}
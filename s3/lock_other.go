@@ -0,0 +1,49 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix
+
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// staleLock is the age of a lock file left by a crashed process.
+const staleLock = time.Minute
+
+// lockFile creates the path exclusively, a lock file older than staleLock
+// is removed.
+func lockFile(path string) (func(), error) {
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("create lock: %w", err)
+		}
+
+		fi, err := os.Stat(path)
+		if attempt > 0 || err != nil || time.Since(fi.ModTime()) < staleLock {
+			return nil, fmt.Errorf("%w: locked by %s", ErrConflict, path)
+		}
+		os.Remove(path)
+	}
+}
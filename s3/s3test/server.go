@@ -0,0 +1,244 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3test provides an in-process fake S3 server for tests.
+// It supports the subset of the S3 API used by perf-fmt with path-style
+// requests.
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+type object struct {
+	body     []byte
+	etag     string
+	encoding string
+}
+
+type Server struct {
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]object
+
+	// BeforePut is called before each put object is processed.
+	// It allows tests to simulate concurrent writes.
+	BeforePut func(key string)
+}
+
+func NewServer() *Server {
+	s := &Server{
+		objects: make(map[string]object),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Session returns an AWS session configured to use the fake server.
+func (s *Server) Session() *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(s.srv.URL),
+		Region:           aws.String("eu-west-3"),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+}
+
+// Get returns the raw body of an object, as stored: gzip encoded objects are
+// not decoded.
+func (s *Server) Get(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.objects[bucket+"/"+key]
+	return o.body, ok
+}
+
+// Set replaces an object's content.
+func (s *Server) Set(bucket, key string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[bucket+"/"+key] = newObject(body, "")
+}
+
+func newObject(body []byte, encoding string) object {
+	sum := md5.Sum(body)
+	return object{
+		body:     body,
+		etag:     `"` + hex.EncodeToString(sum[:]) + `"`,
+		encoding: encoding,
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		// path-style list requests have no key.
+		if r.URL.Query().Get("list-type") == "2" && !strings.Contains(key, "/") {
+			s.listObjects(w, r, key)
+			return
+		}
+		s.getObject(w, key)
+	case http.MethodPut:
+		s.putObject(w, r, key)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *Server) getObject(w http.ResponseWriter, key string) {
+	s.mu.Lock()
+	o, ok := s.objects[key]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	w.Header().Set("ETag", o.etag)
+	if o.encoding != "" {
+		w.Header().Set("Content-Encoding", o.encoding)
+	}
+	w.Write(o.body)
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	if s.BeforePut != nil {
+		_, k, _ := strings.Cut(key, "/")
+		s.BeforePut(k)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, exists := s.objects[key]
+	if m := r.Header.Get("If-Match"); m != "" && (!exists || m != cur.etag) {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	o := newObject(body, r.Header.Get("Content-Encoding"))
+	s.objects[key] = o
+
+	w.Header().Set("ETag", o.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+type listResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	IsTruncated bool
+	Contents    []struct {
+		Key  string
+		ETag string
+		Size int
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+}
+
+// listObjects lists the bucket's objects, in a single page.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	prefix := r.URL.Query().Get("prefix")
+	delimiter := r.URL.Query().Get("delimiter")
+
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.objects))
+	for k := range s.objects {
+		if key, ok := strings.CutPrefix(k, bucket+"/"); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	objects := make(map[string]object, len(keys))
+	for _, k := range keys {
+		objects[k] = s.objects[bucket+"/"+k]
+	}
+	s.mu.Unlock()
+
+	sort.Strings(keys)
+
+	res := listResult{Name: bucket, Prefix: prefix}
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		rest := strings.TrimPrefix(k, prefix)
+		if delimiter != "" {
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				p := prefix + rest[:i+len(delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					res.CommonPrefixes = append(res.CommonPrefixes, struct{ Prefix string }{p})
+				}
+				continue
+			}
+		}
+
+		o := objects[k]
+		res.Contents = append(res.Contents, struct {
+			Key  string
+			ETag string
+			Size int
+		}{k, o.etag, len(o.body)})
+	}
+	res.KeyCount = len(res.Contents) + len(res.CommonPrefixes)
+
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(res)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
@@ -0,0 +1,200 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema generates JSON Schema documents from the Go types of the
+// results and validates JSON documents against them.
+//
+// The generated schemas follow the encoding/json rules: the embedded
+// structs are flattened and, in the documents written by the encoder, the
+// fields without omitempty or omitzero are required. The decoder accepts
+// missing properties, so the input documents only require the fields tagged
+// `schema:"required"`. Unknown properties are allowed, like the decoder does.
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema version of the generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Types is the type keyword, encoded as a string for a single type.
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// Schema is a JSON Schema subset. The empty schema accepts any value.
+type Schema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type    Types    `json:"type,omitempty"`
+	Format  string   `json:"format,omitempty"`
+	Minimum *float64 `json:"minimum,omitempty"`
+	Const   any      `json:"const,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	Items *Schema `json:"items,omitempty"`
+}
+
+// Generate returns the root schema of the documents encoded from the type
+// of v.
+func Generate(v any, title string) *Schema {
+	return root(Of(v), title)
+}
+
+// GenerateInput returns the root schema of the documents decoded into the
+// type of v: only the fields tagged `schema:"required"` are required.
+func GenerateInput(v any, title string) *Schema {
+	return root(generator{input: true}.of(v), title)
+}
+
+func root(s *Schema, title string) *Schema {
+	s.Schema = Draft
+	s.Title = title
+
+	return s
+}
+
+// Of returns the schema of the documents encoded from the type of v, a
+// pointer is dereferenced.
+func Of(v any) *Schema {
+	return generator{}.of(v)
+}
+
+// generator generates the schemas of the encoded documents, or of the
+// decoded ones if input is set.
+type generator struct {
+	input bool
+}
+
+func (g generator) of(v any) *Schema {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return g.generate(t)
+}
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	rawType  = reflect.TypeFor[json.RawMessage]()
+)
+
+func (g generator) generate(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	case rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(g.generate(t.Elem()))
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: Types{"integer"}, Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Slice, reflect.Array:
+		return nullable(&Schema{Type: Types{"array"}, Items: g.generate(t.Elem())})
+	case reflect.Map:
+		return nullable(&Schema{Type: Types{"object"}, AdditionalProperties: g.generate(t.Elem())})
+	case reflect.Struct:
+		s := &Schema{Type: Types{"object"}, Properties: make(map[string]*Schema)}
+		g.addFields(s, t)
+		return s
+	default:
+		// interfaces accept any value.
+		return &Schema{}
+	}
+}
+
+// nullable allows the null value, decoded as the Go zero value.
+func nullable(s *Schema) *Schema {
+	if len(s.Type) > 0 {
+		s.Type = append(s.Type, "null")
+	}
+	return s
+}
+
+// addFields adds the struct fields to the object schema s.
+func (g generator) addFields(s *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// embedded structs without name are flattened.
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.generate(f.Type)
+
+		required := f.Tag.Get("schema") == "required"
+		if !g.input {
+			required = true
+			for _, o := range strings.Split(opts, ",") {
+				if o == "omitempty" || o == "omitzero" {
+					required = false
+				}
+			}
+		}
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBase struct {
+	Hash string    `json:"commit"`
+	Time time.Time `json:"datetime"`
+	Tag  string    `json:"tag,omitempty"`
+}
+
+type testResult struct {
+	testBase
+	Results []struct {
+		Mean float64 `json:"mean"`
+		Runs uint    `json:"runs"`
+	} `json:"results"`
+	Values  map[string]float64 `json:"values,omitempty"`
+	Env     *struct{}          `json:"env,omitempty"`
+	private int
+}
+
+func TestGenerate(t *testing.T) {
+	s := Generate(testResult{}, "test")
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	for _, want := range []string{
+		`"$schema":"https://json-schema.org/draft/2020-12/schema"`,
+		`"datetime":{"type":"string","format":"date-time"}`,
+		`"required":["commit","datetime","results"]`,
+		`"values":{"type":["object","null"],"additionalProperties":{"type":"number"}}`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected %s in %s", want, b)
+		}
+	}
+	if _, ok := s.Properties["private"]; ok {
+		t.Errorf("unexported field in the schema")
+	}
+}
+
+func TestGenerateInput(t *testing.T) {
+	var in struct {
+		Name  string `json:"name" schema:"required"`
+		Value int    `json:"value"`
+	}
+	s := GenerateInput(in, "test")
+
+	if !slices.Equal(s.Required, []string{"name"}) {
+		t.Errorf("unexpected required properties %q", s.Required)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := Generate(testResult{}, "test")
+
+	for _, tc := range []struct {
+		doc  string
+		errs []string
+	}{
+		{doc: `{"commit":"aaaaaaa","datetime":"2024-01-01T00:00:00Z","results":[{"mean":1,"runs":2}],"extra":true}`},
+		{doc: `{"commit":"aaaaaaa","datetime":"2024-01-01T00:00:00Z","results":null,"values":{"a b":1.5}}`},
+		{
+			doc: `{"commit":1,"datetime":"yesterday","results":[{"mean":"1"},{"mean":1,"runs":-1}],"values":{"a b":"x"}}`,
+			errs: []string{
+				`$.commit: expected string, got integer`,
+				`$.datetime: expected a RFC 3339 date-time, got "yesterday"`,
+				`$.results[0].runs: required property is missing`,
+				`$.results[0].mean: expected number, got string`,
+				`$.results[1].runs: expected a value >= 0, got -1`,
+				`$.values["a b"]: expected number, got string`,
+			},
+		},
+		{doc: `[]`, errs: []string{`$: expected object, got array`}},
+	} {
+		errs, err := s.ValidateJSON(strings.NewReader(tc.doc))
+		if err != nil {
+			t.Fatalf("validate %s: %v", tc.doc, err)
+		}
+
+		var got []string
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+		if !slices.Equal(got, tc.errs) {
+			t.Errorf("validate %s:\ngot  %q\nwant %q", tc.doc, got, tc.errs)
+		}
+	}
+}
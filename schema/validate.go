@@ -0,0 +1,154 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is a validation error of the value at the JSON path.
+type Error struct {
+	// Path locates the value, e.g. $.results[0].mean.
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidateJSON decodes the JSON document read from r and validates it.
+func (s *Schema) ValidateJSON(r io.Reader) ([]Error, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("decode json: unexpected data after the document")
+	}
+
+	return s.Validate(v), nil
+}
+
+// Validate validates the decoded JSON value v. The numbers must be decoded
+// as json.Number.
+// It returns the errors ordered by path.
+func (s *Schema) Validate(v any) []Error {
+	var errs []Error
+	s.validate("$", v, &errs)
+	return errs
+}
+
+func (s *Schema) validate(path string, v any, errs *[]Error) {
+	if len(s.Type) > 0 && !slices.Contains(s.Type, typeOf(v)) {
+		// an integer is also a number.
+		if typeOf(v) != "integer" || !slices.Contains(s.Type, "number") {
+			*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf("expected %s, got %s", strings.Join(s.Type, " or "), typeOf(v))})
+			return
+		}
+	}
+
+	if s.Const != nil && fmt.Sprint(v) != fmt.Sprint(s.Const) {
+		*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf("expected %v, got %v", s.Const, v)})
+		return
+	}
+
+	switch v := v.(type) {
+	case string:
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf("expected a RFC 3339 date-time, got %q", v)})
+			}
+		}
+	case json.Number:
+		if s.Minimum != nil {
+			if f, err := v.Float64(); err == nil && f < *s.Minimum {
+				*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf("expected a value >= %g, got %s", *s.Minimum, v)})
+			}
+		}
+	case []any:
+		if s.Items == nil {
+			return
+		}
+		for i, item := range v {
+			s.Items.validate(path+"["+strconv.Itoa(i)+"]", item, errs)
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, Error{Path: propPath(path, name), Message: "required property is missing"})
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				prop = s.AdditionalProperties
+			}
+			if prop != nil {
+				prop.validate(propPath(path, name), v[name], errs)
+			}
+		}
+	}
+}
+
+// typeOf returns the JSON type of the decoded value.
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+var identrxp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// propPath returns the path of the object's property name.
+func propPath(path, name string) string {
+	if identrxp.MatchString(name) {
+		return path + "." + name
+	}
+	return path + "[" + strconv.Quote(name) + "]"
+}
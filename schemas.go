@@ -0,0 +1,231 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lightpanda-io/perf-fmt/custom"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/schema"
+	"github.com/lightpanda-io/perf-fmt/sources"
+	"github.com/lightpanda-io/perf-fmt/store"
+)
+
+// The JSON schemas are stored next to the history.
+const (
+	inputSchemaFile   = "input.schema.json"
+	historySchemaFile = "history.schema.json"
+)
+
+var errInvalid = errors.New("invalid result")
+
+// runSchema prints the JSON schema of a source's results or history.
+func runSchema(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdSchema, flag.ExitOnError)
+
+	hist := flags.Bool("history", false, "print the history schema instead of the result one")
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [schema options] <source>\n", exec, CmdSchema)
+		fmt.Fprintf(stderr, "\nPrint the JSON schema of the source's result files, or of its history.\n")
+		fmt.Fprintf(stderr, "\nThe schema options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	info, err := opts.lookupInfo(flags.Arg(0))
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	s := info.InputSchema()
+	if *hist {
+		s = info.HistorySchema()
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return fmt.Errorf("encode schema: %w", err)
+	}
+
+	return nil
+}
+
+// runValidate checks result files against the source's JSON schema.
+func runValidate(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdValidate, flag.ExitOnError)
+
+	hist := flags.Bool("history", false, "validate history files instead of result files")
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [validate options] <source> <result.json>...\n", exec, CmdValidate)
+		fmt.Fprintf(stderr, "\nCheck the result files against the source's JSON schema and print the\n")
+		fmt.Fprintf(stderr, "errors with their JSON path. The result - is read from stdin.\n")
+		fmt.Fprintf(stderr, "\nThe validate options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) < 2 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	info, err := opts.lookupInfo(args[0])
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	s := info.InputSchema()
+	if *hist {
+		s = info.HistorySchema()
+	}
+
+	invalid := 0
+	for _, name := range args[1:] {
+		var (
+			b   []byte
+			err error
+		)
+		if name == "-" {
+			b, err = io.ReadAll(stdin)
+		} else {
+			b, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return fmt.Errorf("read input file: %w", err)
+		}
+
+		// the raw results are validated once converted.
+		if !*hist {
+			if b, err = info.Read(name, b); err != nil {
+				return fmt.Errorf("read %s: %w", name, err)
+			}
+		}
+
+		errs, err := s.ValidateJSON(bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if len(errs) == 0 {
+			fmt.Fprintf(stdout, "%s: ok\n", name)
+			continue
+		}
+
+		invalid++
+		for _, e := range errs {
+			fmt.Fprintf(stdout, "%s: %s\n", name, e)
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%w: %d invalid files", errInvalid, invalid)
+	}
+
+	return nil
+}
+
+// lookupInfo returns the registered source's info, or the info of the
+// custom source, whose input is any JSON document.
+func (o options) lookupInfo(name string) (sources.Info, error) {
+	if _, _, err := o.lookupSource(name, history.PolicyFail); err != nil {
+		return sources.Info{}, err
+	}
+
+	info, err := sources.Lookup(name)
+	if errors.Is(err, sources.ErrUnknown) {
+		return sources.Info{Name: name, Out: &custom.OutResult{}}, nil
+	}
+
+	return info, err
+}
+
+// schemaFile is an encoded JSON schema stored next to a history.
+type schemaFile struct {
+	name string
+	data []byte
+}
+
+// changedSchemas returns the source's JSON schemas differing from the ones
+// stored next to its history.
+func changedSchemas(ctx context.Context, st store.Store, path string, info sources.Info) ([]schemaFile, error) {
+	var files []schemaFile
+	for _, f := range []struct {
+		name   string
+		schema *schema.Schema
+	}{
+		{inputSchemaFile, info.InputSchema()},
+		{historySchemaFile, info.HistorySchema()},
+	} {
+		b, err := json.MarshalIndent(f.schema, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("encode schema: %w", err)
+		}
+
+		r, err := st.Item(path+"/"+f.name, "application/schema+json").Pull(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("pull %s: %w", f.name, err)
+		}
+		cur, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.name, err)
+		}
+
+		if !bytes.Equal(cur, b) {
+			files = append(files, schemaFile{name: f.name, data: b})
+		}
+	}
+
+	return files, nil
+}
+
+// pushSchemas stores the source's JSON schemas next to its history, only the
+// changed ones are pushed.
+func pushSchemas(ctx context.Context, st store.Store, path string, info sources.Info) error {
+	files, err := changedSchemas(ctx, st, path, info)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := st.Item(path+"/"+f.name, "application/schema+json").Push(ctx, bytes.NewReader(f.data)); err != nil {
+			return fmt.Errorf("push %s: %w", f.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/compare"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/store"
+)
+
+// runServe serves the sources' histories and comparisons over HTTP.
+func runServe(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdServe, flag.ExitOnError)
+
+	addr := flags.String("addr", "127.0.0.1:8080", "HTTP listen address")
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [serve options]\n", exec, CmdServe)
+		fmt.Fprintf(stderr, "\nServe the histories of the store over HTTP:\n")
+		fmt.Fprintf(stderr, "\tGET /<source>/history.json?branch=<branch>\n")
+		fmt.Fprintf(stderr, "\tGET /<source>/compare?a=<commit>&b=<commit>&format=<format>&branch=<branch>\n")
+		fmt.Fprintf(stderr, "\nThe quarantined records are excluded from the histories.\n")
+		fmt.Fprintf(stderr, "\nThe serve options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           serveHandler(st, opts, stderr),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// shutdown the server when the context is done.
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			fmt.Fprintf(stderr, "shutdown: %v\n", err)
+		}
+	}()
+
+	fmt.Fprintf(stderr, "listening on %s\n", *addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve: %w", err)
+	}
+
+	return nil
+}
+
+// serveHandler returns the HTTP handler of the serve command.
+// The errors of the responses' writes are logged to stderr.
+func serveHandler(st store.Store, opts options, stderr io.Writer) http.Handler {
+	// withSource runs fn with the requested source and branch options.
+	withSource := func(fn func(w http.ResponseWriter, r *http.Request, opts options, src Source, path string)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			src, path, err := opts.lookupSource(r.PathValue("source"), history.PolicyFail)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			opts := opts
+			if branch := r.URL.Query().Get("branch"); branch != "" {
+				opts.branch = branch
+			}
+
+			fn(w, r, opts, src, path)
+		}
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{source}/history.json", withSource(func(w http.ResponseWriter, r *http.Request, opts options, src Source, path string) {
+		records, err := pullRecords(r.Context(), st, opts.branchPath(path, opts.branch), src)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := history.Encode(w, history.Active(records)); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", r.URL.Path, err)
+		}
+	}))
+
+	mux.HandleFunc("GET /{source}/compare", withSource(func(w http.ResponseWriter, r *http.Request, opts options, src Source, path string) {
+		q := r.URL.Query()
+
+		f := compare.FormatJSON
+		if v := q.Get("format"); v != "" {
+			var err error
+			if f, err = compare.ParseFormat(v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		a, err := opts.commit(r.Context(), q.Get("a"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := opts.commit(r.Context(), q.Get("b"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c, err := compareCommits(r.Context(), st, opts, src, path, a, b)
+		switch {
+		case errors.Is(err, compare.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, history.ErrAmbiguousHash):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, errEnvMismatch):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if f == compare.FormatJSON {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		if err := c.Write(w, f); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", r.URL.Path, err)
+		}
+	}))
+
+	return mux
+}
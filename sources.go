@@ -0,0 +1,75 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/sources"
+)
+
+// runSources lists the registered and the custom sources with their
+// storage path.
+func runSources(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdSources, flag.ExitOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s\n", exec, CmdSources)
+		fmt.Fprintf(stderr, "\nList the available sources and their storage path.\n")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\tpath\tdescription")
+
+	for _, info := range sources.All() {
+		_, path, err := opts.lookupSource(info.Name, history.PolicyFail)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", info.Name, opts.path(path), describe(info))
+	}
+
+	for _, name := range opts.customSources() {
+		_, path, err := opts.lookupSource(name, history.PolicyFail)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\tcustom source with %d metrics.\n", name, opts.path(path), len(opts.cfg.Source(name).Metrics))
+	}
+
+	return tw.Flush()
+}
+
+// describe returns the source's description.
+func describe(info sources.Info) string {
+	if info.Deprecated {
+		return "DEPRECATED " + info.Description
+	}
+	return info.Description
+}
@@ -0,0 +1,141 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sources is the registry of the result sources.
+// Each source package registers itself on init.
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/schema"
+)
+
+var ErrUnknown = errors.New("unknown source")
+
+// Source appends results and decodes the source's history.
+type Source interface {
+	Append(ctx context.Context,
+		e history.Entry,
+		out io.Writer,
+		all io.Reader, one io.Reader,
+	) error
+	Decode(r io.Reader) ([]history.Record, error)
+}
+
+// Factory returns a source applying the policy p on duplicated commits.
+type Factory func(p history.Policy) Source
+
+// Info describes a registered source.
+type Info struct {
+	Name        string
+	Description string
+	// Path is the default storage path of the source's history.
+	Path string
+	// Deprecated sources are excluded from the summary.
+	Deprecated bool
+	New        Factory
+	// ReadRaw optionally converts a raw result file, e.g. a legacy text
+	// output, into the source's JSON input.
+	ReadRaw func(filename string, data []byte) ([]byte, error)
+	// Migrations are the steps upgrading the stored histories to the
+	// current version of the source's records.
+	Migrations []history.Migration
+	// In and Out are values of the source's input and output result types,
+	// the JSON schemas are generated from them.
+	In  any
+	Out history.Record
+}
+
+// Read returns the JSON input of the raw result file.
+func (i Info) Read(filename string, data []byte) ([]byte, error) {
+	if i.ReadRaw == nil {
+		return data, nil
+	}
+	return i.ReadRaw(filename, data)
+}
+
+// InputSchema returns the JSON schema of the source's result files.
+func (i Info) InputSchema() *schema.Schema {
+	return schema.GenerateInput(i.In, i.Name+" result")
+}
+
+// HistorySchema returns the JSON schema of the source's history.
+func (i Info) HistorySchema() *schema.Schema {
+	version := history.LegacyVersion
+	if v, ok := i.Out.(history.Versioned); ok {
+		version = v.SchemaVersion()
+	}
+
+	return &schema.Schema{
+		Schema: schema.Draft,
+		Title:  i.Name + " history",
+		Type:   schema.Types{"object"},
+		Properties: map[string]*schema.Schema{
+			"version": {Type: schema.Types{"integer"}, Const: version},
+			"entries": {Type: schema.Types{"array"}, Items: schema.Of(i.Out)},
+		},
+		Required: []string{"version", "entries"},
+	}
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Info)
+)
+
+// Register registers the source. It panics if the name is already
+// registered.
+func Register(info Info) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := registry[info.Name]; ok {
+		panic("sources: source registered twice: " + info.Name)
+	}
+	registry[info.Name] = info
+}
+
+// Lookup returns the registered source by name.
+func Lookup(name string) (Info, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	info, ok := registry[name]
+	if !ok {
+		return Info{}, fmt.Errorf("%w: %q", ErrUnknown, name)
+	}
+
+	return info, nil
+}
+
+// All returns the registered sources sorted by name.
+func All() []Info {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	all := make([]Info, 0, len(registry))
+	for _, info := range registry {
+		all = append(all, info)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+
+	return all
+}
@@ -0,0 +1,42 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lightpanda-io/perf-fmt/history"
+)
+
+func TestRegister(t *testing.T) {
+	Register(Info{Name: "test", Path: "test", New: func(p history.Policy) Source { return nil }})
+
+	info, err := Lookup("test")
+	if err != nil || info.Path != "test" {
+		t.Fatalf("lookup: %+v %v", info, err)
+	}
+
+	if _, err := Lookup("unknown"); !errors.Is(err, ErrUnknown) {
+		t.Errorf("expected unknown error, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic on duplicated registration")
+		}
+	}()
+	Register(Info{Name: "test"})
+}
@@ -0,0 +1,112 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stats computes descriptive statistics over metric samples.
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// Summary describes a set of samples.
+type Summary struct {
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+	P95    float64 `json:"p95"`
+	Max    float64 `json:"max"`
+}
+
+// Summarize computes the summary of the samples.
+// It returns the zero Summary for empty samples.
+func Summarize(samples []float64) Summary {
+	if len(samples) == 0 {
+		return Summary{}
+	}
+
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+
+	return Summary{
+		Min:    sorted[0],
+		Median: percentile(sorted, 50),
+		Mean:   Mean(sorted),
+		Stddev: Stddev(sorted),
+		P95:    percentile(sorted, 95),
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+func Mean(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, v := range samples {
+		sum += v
+	}
+
+	return sum / float64(len(samples))
+}
+
+// Stddev returns the sample standard deviation.
+func Stddev(samples []float64) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+
+	mean := Mean(samples)
+
+	var sum float64
+	for _, v := range samples {
+		sum += (v - mean) * (v - mean)
+	}
+
+	return math.Sqrt(sum / float64(len(samples)-1))
+}
+
+func Median(samples []float64) float64 {
+	return Percentile(samples, 50)
+}
+
+// Percentile returns the p-th percentile of the samples using linear
+// interpolation between closest ranks.
+func Percentile(samples []float64, p float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+
+	return percentile(sorted, p)
+}
+
+// percentile expects sorted samples.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
@@ -0,0 +1,49 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	s := Summarize([]float64{4, 1, 3, 2, 5})
+
+	expected := Summary{
+		Min:    1,
+		Median: 3,
+		Mean:   3,
+		Stddev: math.Sqrt(2.5),
+		P95:    4.8,
+		Max:    5,
+	}
+
+	if math.Abs(s.P95-expected.P95) > 1e-9 {
+		t.Errorf("unexpected p95 %v", s.P95)
+	}
+	s.P95 = expected.P95
+
+	if s != expected {
+		t.Errorf("expected %+v, got %+v", expected, s)
+	}
+}
+
+func TestSummarizeSingle(t *testing.T) {
+	s := Summarize([]float64{42})
+	if s != (Summary{Min: 42, Median: 42, Mean: 42, P95: 42, Max: 42}) {
+		t.Errorf("unexpected summary %+v", s)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/lightpanda-io/perf-fmt/s3"
+)
+
+// FileStore stores items as files under a local directory.
+type FileStore struct {
+	Dir string
+}
+
+func (s *FileStore) Item(key, _ string) Item {
+	return &s3.FileIO{Path: filepath.Join(s.Dir, filepath.FromSlash(key))}
+}
+
+func (s *FileStore) List(ctx context.Context, dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, filepath.FromSlash(dir)))
+	if err != nil {
+		// a missing dir is empty, like other stores.
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("list dir: %w", err)
+	}
+
+	var keys []string
+	for _, e := range entries {
+		// the lock files aren't items.
+		if !e.Type().IsRegular() || strings.HasSuffix(e.Name(), s3.LockSuffix) {
+			continue
+		}
+		keys = append(keys, path.Join(dir, e.Name()))
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lightpanda-io/perf-fmt/s3"
+)
+
+// MemStore keeps items in memory.
+// The content is lost when the program exits, it's useful for tests.
+type MemStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+	// versions counts the pushes of each item.
+	versions map[string]int
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		items:    make(map[string][]byte),
+		versions: make(map[string]int),
+	}
+}
+
+func (s *MemStore) Item(key, _ string) Item {
+	return &memIO{store: s, key: key}
+}
+
+func (s *MemStore) List(ctx context.Context, dir string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for k := range s.items {
+		if name, ok := strings.CutPrefix(k, dir+"/"); ok && !strings.Contains(name, "/") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+type memIO struct {
+	store *MemStore
+	key   string
+}
+
+func (m *memIO) Pull(ctx context.Context) (io.ReadCloser, error) {
+	r, _, err := m.PullVersion(ctx)
+	return r, err
+}
+
+func (m *memIO) PullVersion(ctx context.Context) (io.ReadCloser, s3.Version, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	// returns an empty reader if the item doesn't exist, like other IOs.
+	return io.NopCloser(bytes.NewReader(m.store.items[m.key])), m.version(), nil
+}
+
+func (m *memIO) Push(ctx context.Context, r io.Reader) error {
+	return m.push(r, nil)
+}
+
+func (m *memIO) PushVersion(ctx context.Context, r io.Reader, v s3.Version) error {
+	return m.push(r, &v)
+}
+
+// push stores the content. If v is not nil, the push fails with a conflict
+// error when the current version differs.
+func (m *memIO) push(r io.Reader, v *s3.Version) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if v != nil && *v != m.version() {
+		return s3.ErrConflict
+	}
+
+	m.store.items[m.key] = b
+	m.store.versions[m.key]++
+
+	return nil
+}
+
+// version must be called with the store lock held.
+func (m *memIO) version() s3.Version {
+	n, ok := m.store.versions[m.key]
+	if !ok {
+		return ""
+	}
+	return s3.Version(strconv.Itoa(n))
+}
@@ -0,0 +1,60 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/lightpanda-io/perf-fmt/s3"
+)
+
+// S3Store stores items in an AWS S3 bucket.
+type S3Store struct {
+	sess   *session.Session
+	bucket string
+	prefix string
+}
+
+func NewS3Store(sess *session.Session, bucket, prefix string) *S3Store {
+	return &S3Store{
+		sess:   sess,
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+func (s *S3Store) Item(key, contentType string) Item {
+	return s3.NewS3IO(s.sess, s.bucket, join(s.prefix, key), contentType)
+}
+
+func (s *S3Store) List(ctx context.Context, dir string) ([]string, error) {
+	keys, err := s3.List(ctx, s.sess, s.bucket, join(s.prefix, dir)+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	// the keys are relative to the store's prefix.
+	if s.prefix != "" {
+		for i, k := range keys {
+			keys[i] = strings.TrimPrefix(k, s.prefix+"/")
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/lightpanda-io/perf-fmt/s3"
+)
+
+var ErrBadURL = errors.New("bad store url")
+
+// Item is a single object of a store.
+type Item interface {
+	s3.Puller
+	s3.Pusher
+	s3.VersionedPuller
+	s3.VersionedPusher
+}
+
+// Store gives access to the items of a storage backend.
+type Store interface {
+	Item(key, contentType string) Item
+	// List returns the sorted keys of the items directly in the dir, the
+	// items of the sub dirs are not listed.
+	List(ctx context.Context, dir string) ([]string, error)
+}
+
+// Open returns the store described by the rawurl.
+// Supported urls are:
+//
+//	s3://bucket/prefix
+//	file:///var/perf
+//	mem://
+func Open(rawurl string) (Store, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadURL, err)
+	}
+
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("%w: missing bucket", ErrBadURL)
+		}
+
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("new aws session: %w", err)
+		}
+
+		return NewS3Store(sess, u.Host, strings.Trim(u.Path, "/")), nil
+	case "file":
+		if u.Host != "" {
+			return nil, fmt.Errorf("%w: unexpected host %q", ErrBadURL, u.Host)
+		}
+		if u.Path == "" {
+			return nil, fmt.Errorf("%w: missing path", ErrBadURL)
+		}
+
+		return &FileStore{Dir: u.Path}, nil
+	case "mem":
+		return NewMemStore(), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown scheme %q", ErrBadURL, u.Scheme)
+	}
+}
+
+// ObjectKey returns the key of the store's item in the backend, e.g. the
+// S3 object key including the store's prefix.
+func ObjectKey(st Store, key string) string {
+	if s, ok := st.(*S3Store); ok {
+		return join(s.prefix, key)
+	}
+	return key
+}
+
+// join prefixes the key with the prefix if any.
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return path.Join(prefix, key)
+}
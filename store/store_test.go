@@ -0,0 +1,72 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lightpanda-io/perf-fmt/s3/s3test"
+)
+
+func TestList(t *testing.T) {
+	srv := s3test.NewServer()
+	defer srv.Close()
+
+	for name, st := range map[string]Store{
+		"file": &FileStore{Dir: t.TempDir()},
+		"mem":  NewMemStore(),
+		"s3":   NewS3Store(srv.Session(), "bucket", "perf"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, key := range []string{"cdp/history.json", "cdp/a.json", "cdp/branches/b/history.json", "cdpx/c.json"} {
+				if err := st.Item(key, "application/json").Push(ctx, strings.NewReader("{}")); err != nil {
+					t.Fatalf("push %s: %v", key, err)
+				}
+			}
+
+			keys, err := st.List(ctx, "cdp")
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if expected := []string{"cdp/a.json", "cdp/history.json"}; !slices.Equal(keys, expected) {
+				t.Errorf("expected %v, got %v", expected, keys)
+			}
+
+			keys, err = st.List(ctx, "missing")
+			if err != nil || len(keys) != 0 {
+				t.Errorf("unexpected list of a missing dir: %v %v", keys, err)
+			}
+		})
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	for _, tc := range []struct {
+		st  Store
+		key string
+	}{
+		{st: NewS3Store(nil, "bucket", "perf"), key: "perf/cdp/history.json"},
+		{st: NewS3Store(nil, "bucket", ""), key: "cdp/history.json"},
+		{st: NewMemStore(), key: "cdp/history.json"},
+	} {
+		if key := ObjectKey(tc.st, "cdp/history.json"); key != tc.key {
+			t.Errorf("expected %s, got %s", tc.key, key)
+		}
+	}
+}
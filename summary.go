@@ -0,0 +1,172 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/lightpanda-io/perf-fmt/compare"
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+	"github.com/lightpanda-io/perf-fmt/sources"
+	"github.com/lightpanda-io/perf-fmt/summary"
+)
+
+// summarySources returns the sources included in the summary: the
+// registered ones not deprecated and the custom ones.
+func summarySources(opts options) []string {
+	var names []string
+	for _, info := range sources.All() {
+		if !info.Deprecated {
+			names = append(names, info.Name)
+		}
+	}
+
+	return append(names, opts.customSources()...)
+}
+
+// runSummary renders a Markdown report of a commit for all sources.
+func runSummary(ctx context.Context, exec string, opts options, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(CmdSummary, flag.ExitOnError)
+
+	var (
+		baseline = flags.String("baseline", "", "baseline commit, default to the previous commit of each history or to the main branch latest commit with --branch")
+		noise    = flags.Float64("noise", summary.DefaultNoise, "change in percent under which a change is not significant")
+	)
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [options] %s [summary options] <commit>\n", exec, CmdSummary)
+		fmt.Fprintf(stderr, "\nRender a Markdown report of the commit's results for all sources.\n")
+		fmt.Fprintf(stderr, "\nThe summary options are:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		return errors.New("bad arguments")
+	}
+
+	hash, err := opts.commit(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	var base git.CommitHash
+	if *baseline != "" {
+		if base, err = opts.commit(ctx, *baseline); err != nil {
+			return err
+		}
+	}
+
+	st, err := opts.open()
+	if err != nil {
+		return err
+	}
+
+	sum := summary.Summary{Hash: hash, Noise: *noise}
+	for _, name := range summarySources(opts) {
+		src, path, err := opts.lookupSource(name, history.PolicyFail)
+		if err != nil {
+			return err
+		}
+
+		records, err := pullRecords(ctx, st, opts.branchPath(path, opts.branch), src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		// a branch's commit is compared with the main history.
+		var mainRecords []history.Record
+		onBranch := !opts.isMain(opts.branch)
+		if onBranch {
+			if mainRecords, err = pullRecords(ctx, st, opts.branchPath(path, ""), src); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+
+		sec := summarySection(name, records, mainRecords, onBranch, hash, base)
+		if sec.Comparison != nil {
+			if err := opts.checkEnv(sec.Comparison.EnvDiff); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		sum.Sections = append(sum.Sections, sec)
+	}
+
+	return sum.Write(stdout)
+}
+
+// summarySection compares the hash's record with the baseline commit's
+// record. If baseline is empty, the hash is compared with the previous
+// record, or with the latest main record if the records are a branch history.
+// mainRecords are used only for a branch history.
+func summarySection(name string, records, mainRecords []history.Record, onBranch bool, hash, baseline git.CommitHash) summary.Section {
+	sec := summary.Section{Source: name}
+
+	idx, err := history.Index(records, hash)
+	switch {
+	case errors.Is(err, history.ErrAmbiguousHash):
+		sec.Note = "ambiguous commit hash"
+		return sec
+	case err != nil:
+		sec.Note = "no result for this commit"
+		return sec
+	}
+
+	if !onBranch {
+		mainRecords = records
+	}
+
+	var base history.Record
+	switch {
+	case baseline != "":
+		base, err = compare.Find(mainRecords, baseline)
+		switch {
+		case errors.Is(err, history.ErrAmbiguousHash):
+			sec.Note = "ambiguous baseline commit hash"
+			return sec
+		case err != nil:
+			sec.Note = "no result for the baseline commit"
+			return sec
+		}
+	case onBranch:
+		main := history.Active(excludeCommit(mainRecords, hash))
+		if len(main) == 0 {
+			sec.Note = "no main branch result to compare with"
+			return sec
+		}
+		base = main[len(main)-1]
+	default:
+		prev := history.Active(records[:idx])
+		if len(prev) == 0 {
+			sec.Note = "no previous result to compare with"
+			return sec
+		}
+		base = prev[len(prev)-1]
+	}
+
+	c := compare.Records(base, records[idx])
+	sec.Comparison = &c
+
+	return sec
+}
@@ -0,0 +1,112 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package summary renders a Markdown report of a commit's results compared
+// to a baseline, ready to be posted as a GitHub PR comment.
+package summary
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/lightpanda-io/perf-fmt/compare"
+	"github.com/lightpanda-io/perf-fmt/git"
+)
+
+const DefaultNoise = 2.0
+
+// Section is the comparison of one source.
+type Section struct {
+	Source string
+	// Comparison is nil if the commit or the baseline has no result for the
+	// source.
+	Comparison *compare.Comparison
+	// Note explains a missing comparison.
+	Note string
+}
+
+// Summary is the report of a commit.
+type Summary struct {
+	Hash     git.CommitHash
+	Sections []Section
+	// Noise is the relative change in percent under which a change is not
+	// significant.
+	Noise float64
+}
+
+// Write renders the summary in Markdown.
+func (s Summary) Write(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "## Performance summary for %s\n", s.Hash)
+
+	for _, sec := range s.Sections {
+		fmt.Fprintf(&b, "\n### %s\n\n", sec.Source)
+
+		if sec.Comparison == nil {
+			fmt.Fprintf(&b, "_%s_\n", sec.Note)
+			continue
+		}
+
+		c := sec.Comparison
+		fmt.Fprintf(&b, "Compared to %s.\n\n", c.A)
+		fmt.Fprintf(&b, "| | metric | baseline | %s | change |\n", c.B)
+		fmt.Fprintf(&b, "|---|---|---:|---:|---:|\n")
+		for _, r := range c.Rows {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s %s |\n",
+				s.status(r), r.Metric,
+				compare.FormatValue(r.A), compare.FormatValue(r.B),
+				arrow(r), compare.FormatChange(r.Change))
+		}
+		if len(c.EnvDiff) > 0 {
+			fmt.Fprintf(&b, "\n⚠️ The runner environments differ: %s.\n", strings.Join(c.EnvDiff, ", "))
+		}
+	}
+
+	fmt.Fprintf(&b, "\n🟢 improvement, 🔴 degradation, ⚪ change under %.f%%\n", s.Noise)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// status returns a color coded emoji of the row.
+func (s Summary) status(r compare.Row) string {
+	if r.Delta == 0 {
+		return "⚪"
+	}
+
+	// a metric appearing from zero is always significant.
+	significant := r.Change == nil || math.Abs(*r.Change) >= s.Noise
+	switch {
+	case !significant:
+		return "⚪"
+	case r.Worse():
+		return "🔴"
+	default:
+		return "🟢"
+	}
+}
+
+func arrow(r compare.Row) string {
+	switch {
+	case r.Delta > 0:
+		return "⬆️"
+	case r.Delta < 0:
+		return "⬇️"
+	default:
+		return "➡️"
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package summary
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lightpanda-io/perf-fmt/compare"
+)
+
+func TestWrite(t *testing.T) {
+	small, big := 1.0, -20.0
+	s := Summary{
+		Hash:  "bbbbbbb",
+		Noise: DefaultNoise,
+		Sections: []Section{
+			{
+				Source: "cdp",
+				Comparison: &compare.Comparison{
+					A: "aaaaaaa",
+					B: "bbbbbbb",
+					Rows: []compare.Row{
+						{Metric: "duration", A: 100, B: 101, Delta: 1, Change: &small},
+						{Metric: "mem", A: 100, B: 80, Delta: -20, Change: &big},
+						{Metric: "pass", A: 10, B: 8, Delta: -2, Change: &big, HigherIsBetter: true},
+						{Metric: "crash", A: 0, B: 0},
+					},
+					EnvDiff: []string{"cores: 4 != 8"},
+				},
+			},
+			{Source: "wpt", Note: "no previous result to compare with"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	want := "## Performance summary for bbbbbbb\n" +
+		"\n### cdp\n\n" +
+		"Compared to aaaaaaa.\n\n" +
+		"| | metric | baseline | bbbbbbb | change |\n" +
+		"|---|---|---:|---:|---:|\n" +
+		"| ⚪ | duration | 100 | 101 | ⬆️ +1.00% |\n" +
+		"| 🟢 | mem | 100 | 80 | ⬇️ -20.00% |\n" +
+		"| 🔴 | pass | 10 | 8 | ⬇️ -20.00% |\n" +
+		"| ⚪ | crash | 0 | 0 | ➡️ n/a |\n" +
+		"\n⚠️ The runner environments differ: cores: 4 != 8.\n" +
+		"\n### wpt\n\n" +
+		"_no previous result to compare with_\n" +
+		"\n🟢 improvement, 🔴 degradation, ⚪ change under 2%\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2023-2024 Lightpanda (Selecy SAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lightpanda-io/perf-fmt/bench/jsruntime"
+	"github.com/lightpanda-io/perf-fmt/cdp"
+	"github.com/lightpanda-io/perf-fmt/git"
+	"github.com/lightpanda-io/perf-fmt/history"
+)
+
+func cdpRecord(hash git.CommitHash, day, avg int) *cdp.OutResult {
+	return &cdp.OutResult{
+		Entry:       history.Entry{Hash: hash, Time: time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)},
+		DurationAVG: avg,
+	}
+}
+
+func TestSummarySources(t *testing.T) {
+	names := summarySources(options{})
+	if !slices.Contains(names, cdp.Name) {
+		t.Errorf("expected %s in %v", cdp.Name, names)
+	}
+	// the deprecated sources are excluded.
+	if slices.Contains(names, jsruntime.Name) {
+		t.Errorf("unexpected deprecated %s in %v", jsruntime.Name, names)
+	}
+}
+
+func TestSummarySection(t *testing.T) {
+	quarantined := cdpRecord("ccccccc", 3, 1000)
+	quarantined.Quarantine = &history.Quarantine{Reason: "noisy"}
+
+	main := []history.Record{cdpRecord("aaaaaaa", 1, 10), cdpRecord("bbbbbbb", 2, 20), quarantined}
+
+	for name, tc := range map[string]struct {
+		records, main []history.Record
+		onBranch      bool
+		hash, base    git.CommitHash
+		// compared is the baseline commit, empty if there is no comparison.
+		compared git.CommitHash
+		note     string
+	}{
+		"previous": {records: main, hash: "bbbbbbb", compared: "aaaaaaa"},
+		"baseline": {records: main, hash: "bbbbbbb", base: "aaaaaaa", compared: "aaaaaaa"},
+		"no previous result": {
+			records: main, hash: "aaaaaaa",
+			note: "no previous result to compare with",
+		},
+		"no result": {records: main, hash: "ddddddd", note: "no result for this commit"},
+		"ambiguous": {
+			records: append(main, cdpRecord("aaaaaaa1", 4, 30)), hash: "aaaaaaa",
+			note: "ambiguous commit hash",
+		},
+		"missing baseline": {
+			records: main, hash: "bbbbbbb", base: "ddddddd",
+			note: "no result for the baseline commit",
+		},
+		// the quarantined main record isn't a baseline.
+		"branch": {
+			records:  []history.Record{cdpRecord("eeeeeee", 4, 30)},
+			main:     main,
+			onBranch: true, hash: "eeeeeee",
+			compared: "bbbbbbb",
+		},
+		"branch baseline": {
+			records:  []history.Record{cdpRecord("eeeeeee", 4, 30)},
+			main:     main,
+			onBranch: true, hash: "eeeeeee", base: "aaaaaaa",
+			compared: "aaaaaaa",
+		},
+		"branch without main": {
+			records:  []history.Record{cdpRecord("eeeeeee", 4, 30)},
+			onBranch: true, hash: "eeeeeee",
+			note: "no main branch result to compare with",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sec := summarySection(cdp.Name, tc.records, tc.main, tc.onBranch, tc.hash, tc.base)
+			if sec.Source != cdp.Name || sec.Note != tc.note {
+				t.Errorf("unexpected section %+v", sec)
+			}
+
+			switch {
+			case tc.compared == "" && sec.Comparison != nil:
+				t.Errorf("unexpected comparison %+v", sec.Comparison)
+			case tc.compared != "" && (sec.Comparison == nil || sec.Comparison.A != tc.compared || sec.Comparison.B != tc.hash):
+				t.Errorf("expected a comparison with %s, got %+v", tc.compared, sec.Comparison)
+			}
+		})
+	}
+}